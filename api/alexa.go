@@ -2,18 +2,68 @@ package api
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/tbuckley/go-alexa"
 )
 
+// verifyAlexaRequest rejects requests go-alexa would handle without checking them. With the
+// _dev query parameter it skips the signature and timestamp checks, and it fetches certificates
+// from URLs that only start with /echo.api/, e.g. /echo.api/../other-bucket/cert.pem.
+func verifyAlexaRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("_dev") {
+			slog.Warn("Alexa request in development mode rejected")
+			http.Error(w, "Not Authorized", http.StatusUnauthorized)
+			return
+		}
+
+		certURL := r.Header.Get("SignatureCertChainUrl")
+		if !validAlexaCertURL(certURL) {
+			slog.Warn("Alexa request with invalid certificate URL rejected", "url", certURL)
+			http.Error(w, "Not Authorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validAlexaCertURL checks that the certificate is served by Amazon from s3.amazonaws.com/echo.api/.
+func validAlexaCertURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "https" || u.User != nil {
+		return false
+	}
+	if host := strings.ToLower(u.Host); host != "s3.amazonaws.com" && host != "s3.amazonaws.com:443" {
+		return false
+	}
+	return u.RawPath == "" && u.Path == path.Clean(u.Path) && strings.HasPrefix(u.Path, "/echo.api/")
+}
+
 func (ws *WebServer) alexa(w http.ResponseWriter, r *http.Request) {
-	req := alexa.GetEchoRequest(r)
+	ws.alexaRequest(w, r, alexa.GetEchoRequest(r))
+}
 
+// alexaRequest handles the verified request of the custom skill.
+func (ws *WebServer) alexaRequest(w http.ResponseWriter, r *http.Request, req *alexa.EchoRequest) {
 	if req.GetRequestType() == "IntentRequest" || req.GetRequestType() == "LaunchRequest" {
 		res := alexa.NewResponse()
 
+		// Device is an optional slot, intents address the default device without it.
+		deviceName, _ := req.GetSlotValue("Device")
+		d, err := ws.deviceByName(deviceName)
+		if err != nil {
+			writeAlexaError(w, res, err)
+			return
+		}
+
 		switch req.GetIntentName() {
 		case "VentClearLevelIntent":
 			level, err := req.GetSlotValue("VentLevel")
@@ -22,7 +72,7 @@ func (ws *WebServer) alexa(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			err = ws.ventLevel(r.Context(), level)
+			err = ws.ventLevel(r.Context(), d, level)
 			if err != nil {
 				writeAlexaError(w, res, err)
 				return
@@ -30,7 +80,7 @@ func (ws *WebServer) alexa(w http.ResponseWriter, r *http.Request) {
 
 			writeAlexaSuccess(w, res, fmt.Sprintf("OK! Level %s set.", level))
 		case "VentClearPauseIntent":
-			err := ws.ventPause(r.Context())
+			err := ws.ventPause(r.Context(), d)
 			if err != nil {
 				writeAlexaError(w, res, err)
 				return
@@ -42,8 +92,9 @@ func (ws *WebServer) alexa(w http.ResponseWriter, r *http.Request) {
 				writeAlexaError(w, res, err)
 				return
 			}
+			mode = normalizeValue(mode)
 
-			err = ws.ventMode(r.Context(), mode)
+			err = ws.ventMode(r.Context(), d, mode)
 			if err != nil {
 				writeAlexaError(w, res, err)
 				return
@@ -55,23 +106,117 @@ func (ws *WebServer) alexa(w http.ResponseWriter, r *http.Request) {
 				writeAlexaError(w, res, err)
 				return
 			}
+			state = normalizeValue(state)
 
-			err = ws.ventPower(r.Context(), state)
+			err = ws.ventPower(r.Context(), d, state)
 			if err != nil {
 				writeAlexaError(w, res, err)
 				return
 			}
 			writeAlexaSuccess(w, res, fmt.Sprintf("OK! Power %s.", state))
+		case "VentClearBoostIntent":
+			level, err := req.GetSlotValue("VentLevel")
+			if err != nil {
+				writeAlexaError(w, res, err)
+				return
+			}
+
+			slot, err := req.GetSlotValue("Duration")
+			if err != nil {
+				writeAlexaError(w, res, err)
+				return
+			}
+
+			duration, err := parseAlexaDuration(slot)
+			if err != nil {
+				writeAlexaError(w, res, err)
+				return
+			}
+
+			if def, _ := ws.defaultDevice(); d != def {
+				writeAlexaError(w, res, fmt.Errorf("%w: boost is supported only for the default device", errInvalidRequest))
+				return
+			}
+
+			_, err = ws.ventBoost(r.Context(), level, duration)
+			if err != nil {
+				writeAlexaError(w, res, err)
+				return
+			}
+			writeAlexaSuccess(w, res, fmt.Sprintf("OK! Boosting at level %s for %s.", level, describeDuration(duration)))
+		case "VentClearStatusIntent":
+			status, err := ws.ventStatus(r.Context(), d)
+			if err != nil {
+				writeAlexaError(w, res, err)
+				return
+			}
+			writeAlexaSuccess(w, res, describeStatus(status))
 		default:
 			writeAlexaSuccess(w, res, "Hello there, please say a vent action.")
 		}
 	}
 }
 
+var alexaDurationRegexp = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseAlexaDuration parses the ISO 8601 duration of AMAZON.DURATION slots, e.g. PT1H30M.
+func parseAlexaDuration(s string) (time.Duration, error) {
+	m := alexaDurationRegexp.FindStringSubmatch(s)
+	if m == nil || s == "P" || s == "PT" {
+		return 0, fmt.Errorf("%w: invalid duration: %s", errInvalidRequest, s)
+	}
+
+	var d time.Duration
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return 0, fmt.Errorf("%w: invalid duration: %s", errInvalidRequest, s)
+		}
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
+
+func describeDuration(d time.Duration) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return "1 " + unit
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+
+	hours, minutes := int(d.Hours()), int(d.Minutes())%60
+	switch {
+	case hours > 0 && minutes > 0:
+		return plural(hours, "hour") + " and " + plural(minutes, "minute")
+	case hours > 0:
+		return plural(hours, "hour")
+	default:
+		return plural(minutes, "minute")
+	}
+}
+
+func describeStatus(status *ventStatus) string {
+	if status.Power == "off" {
+		return "The ventilation is powered off."
+	}
+
+	var level string
+	if status.Level == "pause" {
+		level = "paused"
+	} else {
+		level = fmt.Sprintf("running at level %s", status.Level)
+	}
+	return fmt.Sprintf("The ventilation is %s in %s mode.", level, status.Mode)
+}
+
 func writeAlexaError(w http.ResponseWriter, res *alexa.EchoResponse, err error) {
-	log.Printf("Alexa error: %s", err.Error())
+	slog.Warn("Alexa request failed", "error", err)
 
-	res.OutputSpeech("Sorry! I didn't understand your request.")
+	res.OutputSpeech(classifyError(err).speech)
 	res.EndSession(true)
 
 	json, _ := res.ToJSON()
@@ -80,7 +225,7 @@ func writeAlexaError(w http.ResponseWriter, res *alexa.EchoResponse, err error)
 }
 
 func writeAlexaSuccess(w http.ResponseWriter, res *alexa.EchoResponse, message string) {
-	log.Printf("Alexa output: %s", message)
+	slog.Info("Alexa response", "speech", message)
 
 	res.OutputSpeech(message)
 	res.EndSession(true)
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+	"github.com/mtojek/spiroflex-vent-clear/econet/econettest"
+	"github.com/tbuckley/go-alexa"
+)
+
+// fakeDevice answers installation requests of the ventilation unit and records modified parameters.
+type fakeDevice struct {
+	m      sync.Mutex
+	values map[string]string
+}
+
+func (d *fakeDevice) respond(ops []econet.OperationRequest) []econet.OperationResponse {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	var resp []econet.OperationResponse
+	for _, op := range ops {
+		r := econet.OperationResponse{Name: op.Name}
+		switch op.Name {
+		case econet.GET_COMPONENTS_ON_BUS:
+			r.Targets = []econet.TargetResponse{{Component: "1", Parameters: []byte(`{"componentName":"ecoVENT MINI OEM"}`)}}
+		case econet.PARAMS_MODIFICATION:
+			for _, target := range op.Targets {
+				b, _ := json.Marshal(target.Parameters)
+				json.Unmarshal(b, &d.values)
+				r.Targets = append(r.Targets, econet.TargetResponse{Component: target.Component})
+			}
+		}
+		resp = append(resp, r)
+	}
+	return resp
+}
+
+func (d *fakeDevice) value(id string) string {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	return d.values[id]
+}
+
+func newTestWebServer(t *testing.T) (*WebServer, *fakeDevice) {
+	t.Helper()
+
+	device := &fakeDevice{values: map[string]string{}}
+	broker := econettest.NewBroker()
+	broker.Handle(econettest.Respond(device.respond))
+
+	c := &spiroflex.Config{
+		Installations: []spiroflex.Installation{{Name: "Home", Devices: []spiroflex.Device{{Name: "Living room"}}}},
+	}
+	sessions := econet.NewManagerWithTransport(c, econet.Transport{
+		Credentials: econettest.StaticCredentials(),
+		HTTP:        econettest.InstallationsAPI(econet.Installation{ID: "installation-1", Name: "Home", HasAccess: true, IsConnected: true}),
+		MQTT:        broker,
+	})
+	t.Cleanup(sessions.Close)
+
+	return &WebServer{c: c, devices: configuredDevices(c), sessions: sessions}, device
+}
+
+func TestAlexaCapitalizedSlotValues(t *testing.T) {
+	ws, device := newTestWebServer(t)
+
+	tests := []struct {
+		intent   string
+		slot     string
+		value    string
+		param    econet.Param
+		expected string
+	}{
+		{intent: "VentClearModeIntent", slot: "VentMode", value: "Manual", param: econet.ParamVentMode, expected: "manual"},
+		{intent: "VentClearPowerIntent", slot: "PowerState", value: " On", param: econet.ParamVentPower, expected: "on"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.intent, func(t *testing.T) {
+			req := &alexa.EchoRequest{Request: alexa.EchoReqBody{
+				Type: "IntentRequest",
+				Intent: alexa.EchoIntent{
+					Name:  tt.intent,
+					Slots: map[string]alexa.EchoSlot{tt.slot: {Name: tt.slot, Value: tt.value}},
+				},
+			}}
+
+			w := httptest.NewRecorder()
+			ws.alexaRequest(w, httptest.NewRequest(http.MethodPost, "/alexa", nil), req)
+			if !strings.Contains(w.Body.String(), "OK!") {
+				t.Fatalf("expected success, got %s", w.Body.String())
+			}
+
+			raw, _ := tt.param.Encode(tt.expected)
+			if got := device.value(tt.param.ID); got != raw {
+				t.Errorf("expected %s=%s, got %q", tt.param.ID, raw, got)
+			}
+		})
+	}
+}
+
+func TestAlexaUnverifiedRequests(t *testing.T) {
+	ws, device := newTestWebServer(t)
+	ws.c.API.Alexa = true
+	ws.c.Alexa.AppID = "amzn1.ask.skill.test"
+	handler := ws.Handler()
+
+	body := `{"version":"1.0","session":{"application":{"applicationId":"amzn1.ask.skill.test"}},` +
+		`"request":{"type":"IntentRequest","timestamp":"2020-01-01T00:00:00Z","intent":{"name":"VentClearPauseIntent"}}}`
+
+	tests := []struct {
+		name    string
+		target  string
+		certURL string
+	}{
+		{name: "development mode", target: "/alexa?_dev=1"},
+		{name: "empty development mode", target: "/alexa?_dev", certURL: "https://s3.amazonaws.com/echo.api/echo-api-cert.pem"},
+		{name: "certificate outside echo.api", target: "/alexa", certURL: "https://s3.amazonaws.com/echo.api/../attacker/cert.pem"},
+		{name: "certificate on another host", target: "/alexa", certURL: "https://attacker.example.com/echo.api/cert.pem"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(body))
+			if tt.certURL != "" {
+				r.Header.Set("SignatureCertChainUrl", tt.certURL)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code < 400 || w.Code >= 500 {
+				t.Errorf("expected a 4xx status, got %d: %s", w.Code, w.Body.String())
+			}
+			if got := device.value(econet.ParamVentLevel.ID); got != "" {
+				t.Errorf("expected the level unchanged, got %q", got)
+			}
+		})
+	}
+}
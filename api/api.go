@@ -3,38 +3,34 @@ package api
 import (
 	"context"
 	"fmt"
-	"slices"
-	"strconv"
+	"strings"
+	"time"
 
+	"github.com/mtojek/spiroflex-vent-clear/boost"
 	"github.com/mtojek/spiroflex-vent-clear/econet"
 )
 
-func (ws *WebServer) ventLevel(ctx context.Context, levelStr string) error {
-	level, err := strconv.Atoi(levelStr)
-	if err != nil {
-		return fmt.Errorf("can't convert level to int: %w", err)
-	}
+const maxBoostDuration = 12 * time.Hour
 
-	if level < 1 || level > 3 {
-		return fmt.Errorf("level must be between 1 and 3")
+func (ws *WebServer) ventLevel(ctx context.Context, d device, level string) error {
+	if _, err := econet.ParamVentLevel.Encode(level); err != nil {
+		return err
 	}
 
-	level += 2 // levels are enumerated from 3 to 5
-
-	session, targetComponentID, err := ws.prepareEconet(ctx)
+	session, targetComponentID, err := ws.prepareEconet(ctx, d)
 	if err != nil {
 		return err
 	}
 
-	err = session.VentLevel(ctx, targetComponentID, fmt.Sprintf("%d", level))
+	err = session.VentLevel(ctx, targetComponentID, level)
 	if err != nil {
 		return fmt.Errorf("unable to modify parameters: %w", err)
 	}
 	return nil
 }
 
-func (ws *WebServer) ventPause(ctx context.Context) error {
-	session, targetComponentID, err := ws.prepareEconet(ctx)
+func (ws *WebServer) ventPause(ctx context.Context, d device) error {
+	session, targetComponentID, err := ws.prepareEconet(ctx, d)
 	if err != nil {
 		return err
 	}
@@ -46,14 +42,13 @@ func (ws *WebServer) ventPause(ctx context.Context) error {
 	return nil
 }
 
-func (ws *WebServer) ventMode(ctx context.Context, mode string) error {
-	if mode == "schedule" {
-		mode = econet.PARAM_MODE_SCHEDULE
-	} else {
-		mode = econet.PARAM_MODE_MANUAL
+func (ws *WebServer) ventMode(ctx context.Context, d device, mode string) error {
+	mode = normalizeValue(mode)
+	if _, err := econet.ParamVentMode.Encode(mode); err != nil {
+		return err
 	}
 
-	session, targetComponentID, err := ws.prepareEconet(ctx)
+	session, targetComponentID, err := ws.prepareEconet(ctx, d)
 	if err != nil {
 		return err
 	}
@@ -65,14 +60,13 @@ func (ws *WebServer) ventMode(ctx context.Context, mode string) error {
 	return nil
 }
 
-func (ws *WebServer) ventPower(ctx context.Context, state string) error {
-	if state == "on" {
-		state = econet.PARAM_POWER_ON
-	} else {
-		state = econet.PARAM_POWER_OFF
+func (ws *WebServer) ventPower(ctx context.Context, d device, state string) error {
+	state = normalizeValue(state)
+	if _, err := econet.ParamVentPower.Encode(state); err != nil {
+		return err
 	}
 
-	session, targetComponentID, err := ws.prepareEconet(ctx)
+	session, targetComponentID, err := ws.prepareEconet(ctx, d)
 	if err != nil {
 		return err
 	}
@@ -84,40 +78,136 @@ func (ws *WebServer) ventPower(ctx context.Context, state string) error {
 	return nil
 }
 
-func (ws *WebServer) prepareEconet(ctx context.Context) (*econet.MQTTSession, string, error) {
-	client, err := econet.New(ctx, ws.c)
+// normalizeValue lowercases the value, so e.g. Alexa slot values like "Manual" are accepted.
+func normalizeValue(v string) string {
+	return strings.ToLower(strings.TrimSpace(v))
+}
+
+type ventStatus struct {
+	Level string `json:"level"`
+	Mode  string `json:"mode"`
+	Power string `json:"power"`
+}
+
+func (ws *WebServer) ventStatus(ctx context.Context, d device) (*ventStatus, error) {
+	session, targetComponentID, err := ws.prepareEconet(ctx, d)
 	if err != nil {
-		return nil, "", fmt.Errorf("unable to create client: %w", err)
+		return nil, err
 	}
 
-	installations, err := client.Installations(ctx)
+	values, err := session.GetValues(ctx, targetComponentID, econet.ParamVentLevel.ID, econet.ParamVentMode.ID, econet.ParamVentPower.ID)
 	if err != nil {
-		return nil, "", fmt.Errorf("unable to fetch installations: %w", err)
+		return nil, fmt.Errorf("unable to read parameters: %w", err)
 	}
 
-	i := slices.IndexFunc(installations, func(ins econet.Installation) bool {
-		return ins.Name == ws.c.Installation.Name
-	})
-	if i < 0 {
-		return nil, "", fmt.Errorf("installation not found or invalid name: %w", err)
+	return &ventStatus{
+		Level: values.Describe(econet.ParamVentLevel),
+		Mode:  values.Describe(econet.ParamVentMode),
+		Power: values.Describe(econet.ParamVentPower),
+	}, nil
+}
+
+func (ws *WebServer) ventSchedule(ctx context.Context, d device) (econet.WeeklySchedule, error) {
+	session, targetComponentID, err := ws.prepareEconet(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule, err := session.GetSchedule(ctx, targetComponentID, ws.c.DeviceSchedule.Params)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read schedule: %w", err)
+	}
+	return schedule, nil
+}
+
+func (ws *WebServer) ventBoost(ctx context.Context, level string, d time.Duration) (*boost.State, error) {
+	if _, err := econet.ParamVentLevel.Encode(level); err != nil {
+		return nil, err
+	}
+	if d < time.Minute || d > maxBoostDuration {
+		return nil, fmt.Errorf("%w: boost duration must be between 1 minute and %s", errInvalidRequest, maxBoostDuration)
+	}
+	return ws.booster.Start(ctx, level, d)
+}
+
+// vent adapts the web server operations on the default device to boost.Vent.
+type vent struct {
+	ws *WebServer
+}
+
+func (v *vent) Status(ctx context.Context) (boost.Snapshot, error) {
+	d, err := v.ws.defaultDevice()
+	if err != nil {
+		return boost.Snapshot{}, err
+	}
+
+	status, err := v.ws.ventStatus(ctx, d)
+	if err != nil {
+		return boost.Snapshot{}, err
+	}
+	return boost.Snapshot{Level: status.Level, Mode: status.Mode, Power: status.Power}, nil
+}
+
+func (v *vent) SetLevel(ctx context.Context, level string) error {
+	d, err := v.ws.defaultDevice()
+	if err != nil {
+		return err
 	}
-	installationID := installations[i].ID
 
-	session, err := client.MQTT(ctx, installationID)
+	if level == "pause" {
+		return v.ws.ventPause(ctx, d)
+	}
+	return v.ws.ventLevel(ctx, d, level)
+}
+
+func (v *vent) SetMode(ctx context.Context, mode string) error {
+	d, err := v.ws.defaultDevice()
 	if err != nil {
-		return nil, "", fmt.Errorf("MQTT error: %w", err)
+		return err
 	}
+	return v.ws.ventMode(ctx, d, mode)
+}
 
-	gcob, err := session.GetComponentsOnBus(ctx)
+func (v *vent) SetPower(ctx context.Context, power string) error {
+	d, err := v.ws.defaultDevice()
 	if err != nil {
-		return nil, "", fmt.Errorf("unable to fetch components on bus: %w", err)
+		return err
+	}
+	return v.ws.ventPower(ctx, d, power)
+}
+
+// scheduledVent applies scheduler actions, during a boost they change the state restored afterwards.
+type scheduledVent struct {
+	vent
+}
+
+func (v *scheduledVent) SetLevel(ctx context.Context, level string) error {
+	deferred, err := v.ws.booster.Defer(func(previous *boost.Snapshot) {
+		previous.Level = level
+		previous.Mode = econet.ParamVentMode.False
+	})
+	if deferred {
+		return err
+	}
+	return v.vent.SetLevel(ctx, level)
+}
+
+func (v *scheduledVent) SetMode(ctx context.Context, mode string) error {
+	deferred, err := v.ws.booster.Defer(func(previous *boost.Snapshot) { previous.Mode = mode })
+	if deferred {
+		return err
 	}
+	return v.vent.SetMode(ctx, mode)
+}
 
-	var targetComponentID string
-	for _, c := range gcob {
-		if c.ComponentName == "ecoVENT MINI OEM" {
-			targetComponentID = c.ComponentID
-		}
+func (v *scheduledVent) SetPower(ctx context.Context, power string) error {
+	deferred, err := v.ws.booster.Defer(func(previous *boost.Snapshot) { previous.Power = power })
+	if deferred {
+		return err
 	}
-	return session, targetComponentID, nil
+	return v.vent.SetPower(ctx, power)
+}
+
+func (ws *WebServer) prepareEconet(ctx context.Context, d device) (*econet.MQTTSession, string, error) {
+	return ws.sessions.Target(ctx, d.installation, d.Device)
 }
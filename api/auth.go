@@ -0,0 +1,183 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	errUnauthenticated = errors.New("authentication required")
+	errInvalidCreds    = errors.New("invalid credentials")
+	errForbidden       = errors.New("insufficient scope")
+)
+
+// principal is an authenticated API client.
+type principal struct {
+	name  string
+	scope string
+}
+
+func (p principal) allows(scope string) bool {
+	return p.scope == spiroflex.ScopeControl || p.scope == scope
+}
+
+// authenticator identifies clients by credentials carried by requests. It returns ok=false
+// if the request doesn't carry credentials it understands, and an error if they're invalid.
+type authenticator interface {
+	authenticate(r *http.Request) (p principal, ok bool, err error)
+}
+
+func newAuthenticators(c spiroflex.Auth) []authenticator {
+	var authenticators []authenticator
+	if len(c.Tokens) > 0 {
+		authenticators = append(authenticators, tokenAuthenticator(c.Tokens))
+	}
+	if len(c.Users) > 0 {
+		authenticators = append(authenticators, basicAuthenticator(c.Users))
+	}
+	if len(c.ClientCerts) > 0 {
+		authenticators = append(authenticators, certAuthenticator(c.ClientCerts))
+	}
+	return authenticators
+}
+
+type tokenAuthenticator []spiroflex.AuthToken
+
+func (a tokenAuthenticator) authenticate(r *http.Request) (principal, bool, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return principal{}, false, nil
+	}
+
+	// Compare hashes, so the comparison takes the same time regardless of the token length.
+	sum := sha256.Sum256([]byte(token))
+	for _, t := range a {
+		expected := sha256.Sum256([]byte(t.Token))
+		if subtle.ConstantTimeCompare(sum[:], expected[:]) == 1 {
+			return principal{name: "token " + t.Name, scope: t.Scope}, true, nil
+		}
+	}
+	return principal{}, true, errInvalidCreds
+}
+
+// dummyPasswordHash is compared for unknown users, so they take as long to reject as wrong
+// passwords and can't be told apart by timing.
+const dummyPasswordHash = "$2a$10$ckEihX3268T85.oXx.oSM.FEn.Nq9HuPznph8fgQSluDD7.PzMpZi"
+
+type basicAuthenticator []spiroflex.AuthUser
+
+func (a basicAuthenticator) authenticate(r *http.Request) (principal, bool, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return principal{}, false, nil
+	}
+
+	i := slices.IndexFunc(a, func(u spiroflex.AuthUser) bool { return u.Username == username })
+	if i < 0 {
+		bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(password))
+		return principal{}, true, errInvalidCreds
+	}
+	if bcrypt.CompareHashAndPassword([]byte(a[i].PasswordHash), []byte(password)) != nil {
+		return principal{}, true, errInvalidCreds
+	}
+	return principal{name: "user " + a[i].Username, scope: a[i].Scope}, true, nil
+}
+
+type certAuthenticator []spiroflex.AuthClientCert
+
+func (a certAuthenticator) authenticate(r *http.Request) (principal, bool, error) {
+	// Only certificates verified against the client CA of the TLS server are considered.
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return principal{}, false, nil
+	}
+
+	commonName := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	for _, c := range a {
+		if c.CommonName == commonName {
+			return principal{name: "certificate " + c.CommonName, scope: c.Scope}, true, nil
+		}
+	}
+	return principal{}, true, errInvalidCreds
+}
+
+// requireScope rejects requests of clients not authenticated with the scope. Requests pass
+// through if no clients are configured.
+func (ws *WebServer) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(ws.authenticators) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			p, err := ws.authenticate(r)
+			if err != nil {
+				slog.Warn("Rejected unauthenticated request", "method", r.Method, "path", r.URL.Path, "remote_addr", r.RemoteAddr, "error", err)
+				if len(ws.c.API.Auth.Users) > 0 {
+					w.Header().Set("WWW-Authenticate", `Basic realm="ventclear"`)
+				}
+				writeError(w, err)
+				return
+			}
+
+			if !p.allows(scope) {
+				slog.Warn("Rejected request, scope required", "method", r.Method, "path", r.URL.Path, "principal", p.name, "scope", scope)
+				writeError(w, errForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireMethodScope requires the read scope for safe methods and the control scope for others.
+func (ws *WebServer) requireMethodScope(next http.Handler) http.Handler {
+	read, control := ws.requireScope(spiroflex.ScopeRead)(next), ws.requireScope(spiroflex.ScopeControl)(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			read.ServeHTTP(w, r)
+			return
+		}
+		control.ServeHTTP(w, r)
+	})
+}
+
+func (ws *WebServer) authenticate(r *http.Request) (principal, error) {
+	for _, a := range ws.authenticators {
+		p, ok, err := a.authenticate(r)
+		if !ok {
+			continue
+		}
+		if err != nil {
+			return principal{}, err
+		}
+		return p, nil
+	}
+	return principal{}, errUnauthenticated
+}
+
+// openEndpoints lists enabled endpoints guarded by api.auth, they're open if no clients are configured.
+func openEndpoints(c spiroflex.API) []string {
+	var endpoints []string
+	if c.Rest {
+		endpoints = append(endpoints, "/api")
+	}
+	if c.Metrics {
+		endpoints = append(endpoints, "/metrics")
+	}
+	if c.Debug {
+		endpoints = append(endpoints, "/debug/econet")
+	}
+	if c.SmartHome {
+		endpoints = append(endpoints, "/alexa/smarthome")
+	}
+	return endpoints
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestRequireMethodScope(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt failed: %v", err)
+	}
+
+	c := &spiroflex.Config{
+		API: spiroflex.API{
+			Auth: spiroflex.Auth{
+				Tokens: []spiroflex.AuthToken{
+					{Name: "tablet", Token: "tablet-token", Scope: spiroflex.ScopeRead},
+					{Name: "home", Token: "home-token", Scope: spiroflex.ScopeControl},
+				},
+				Users: []spiroflex.AuthUser{
+					{Username: "admin", PasswordHash: string(hash), Scope: spiroflex.ScopeControl},
+				},
+				ClientCerts: []spiroflex.AuthClientCert{
+					{CommonName: "panel", Scope: spiroflex.ScopeRead},
+				},
+			},
+		},
+	}
+	ws := &WebServer{c: c, authenticators: newAuthenticators(c.API.Auth)}
+	handler := ws.requireMethodScope(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	bearer := func(token string) func(r *http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+	}
+	basic := func(username, password string) func(r *http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth(username, password) }
+	}
+	cert := func(commonName string) func(r *http.Request) {
+		return func(r *http.Request) {
+			r.TLS = &tls.ConnectionState{
+				VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: commonName}}}},
+			}
+		}
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		auth     func(r *http.Request)
+		expected int
+	}{
+		{name: "no credentials", method: http.MethodGet, expected: http.StatusUnauthorized},
+		{name: "read token reads", method: http.MethodGet, auth: bearer("tablet-token"), expected: http.StatusOK},
+		{name: "read token controls", method: http.MethodPost, auth: bearer("tablet-token"), expected: http.StatusForbidden},
+		{name: "control token controls", method: http.MethodPost, auth: bearer("home-token"), expected: http.StatusOK},
+		{name: "invalid token", method: http.MethodGet, auth: bearer("guess"), expected: http.StatusUnauthorized},
+		{name: "basic auth", method: http.MethodPost, auth: basic("admin", "secret"), expected: http.StatusOK},
+		{name: "wrong password", method: http.MethodGet, auth: basic("admin", "guess"), expected: http.StatusUnauthorized},
+		{name: "unknown user", method: http.MethodGet, auth: basic("guest", "secret"), expected: http.StatusUnauthorized},
+		{name: "client certificate reads", method: http.MethodGet, auth: cert("panel"), expected: http.StatusOK},
+		{name: "client certificate controls", method: http.MethodPost, auth: cert("panel"), expected: http.StatusForbidden},
+		{name: "unknown client certificate", method: http.MethodGet, auth: cert("intruder"), expected: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/api/vent/status", nil)
+			if tt.auth != nil {
+				tt.auth(r)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.expected {
+				t.Errorf("expected status %d, got %d", tt.expected, w.Code)
+			}
+		})
+	}
+}
+
+func TestRequireScopeWithoutClients(t *testing.T) {
+	ws := &WebServer{c: &spiroflex.Config{}}
+	handler := ws.requireMethodScope(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/vent/pause", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected open API, got status %d", w.Code)
+	}
+}
+
+func TestDummyPasswordHash(t *testing.T) {
+	// An invalid hash would be rejected without hashing the password, revealing unknown users.
+	cost, err := bcrypt.Cost([]byte(dummyPasswordHash))
+	if err != nil {
+		t.Fatalf("invalid dummy hash: %v", err)
+	}
+	if cost != bcrypt.DefaultCost {
+		t.Errorf("expected dummy hash cost %d, got %d", bcrypt.DefaultCost, cost)
+	}
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mtojek/spiroflex-vent-clear"
+)
+
+var errNoDevices = errors.New("no devices are configured")
+
+// device is a ventilation unit of a configured installation.
+type device struct {
+	installation string
+	spiroflex.Device
+}
+
+func configuredDevices(c *spiroflex.Config) []device {
+	var devices []device
+	for _, ins := range c.AllInstallations() {
+		for _, d := range ins.Devices {
+			devices = append(devices, device{installation: ins.Name, Device: d})
+		}
+	}
+	return devices
+}
+
+func (ws *WebServer) defaultDevice() (device, error) {
+	if len(ws.devices) == 0 {
+		return device{}, errNoDevices
+	}
+	return ws.devices[0], nil
+}
+
+// findDevice looks up a device by its friendly or component name in the installation,
+// addressed by its name or ID.
+func (ws *WebServer) findDevice(ctx context.Context, installation, name string) (device, error) {
+	if !slices.ContainsFunc(ws.devices, func(d device) bool { return d.installation == installation }) {
+		resolved, err := ws.installationName(ctx, installation)
+		if err != nil {
+			return device{}, err
+		}
+		installation = resolved
+	}
+
+	var found bool
+	for _, d := range ws.devices {
+		if d.installation != installation {
+			continue
+		}
+		found = true
+
+		if strings.EqualFold(d.Name, name) || d.Component == name {
+			return d, nil
+		}
+	}
+
+	if !found {
+		return device{}, fmt.Errorf("installation %s is %w", installation, spiroflex.ErrNotConfigured)
+	}
+	return device{}, fmt.Errorf("device %s is %w in installation %s", name, spiroflex.ErrNotConfigured, installation)
+}
+
+// installationName returns the name of the installation with the ID, or the ID itself if
+// the account has no such installation.
+func (ws *WebServer) installationName(ctx context.Context, id string) (string, error) {
+	installations, err := ws.sessions.Installations(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, ins := range installations {
+		if ins.ID == id {
+			return ins.Name, nil
+		}
+	}
+	return id, nil
+}
+
+// deviceByName looks up a device by its friendly name, falling back to the default device
+// if the name is empty.
+func (ws *WebServer) deviceByName(name string) (device, error) {
+	installation, d, err := ws.c.LookupDevice(name)
+	if err != nil {
+		return device{}, err
+	}
+	return device{installation: installation, Device: d}, nil
+}
+
+type deviceContextKey struct{}
+
+// withDevice resolves the device addressed by the installation and device URL parameters.
+func (ws *WebServer) withDevice(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		installation, err := url.PathUnescape(chi.URLParam(r, "installation"))
+		if err != nil {
+			writeError(w, fmt.Errorf("%w: installation: %w", errInvalidRequest, err))
+			return
+		}
+
+		name, err := url.PathUnescape(chi.URLParam(r, "device"))
+		if err != nil {
+			writeError(w, fmt.Errorf("%w: device: %w", errInvalidRequest, err))
+			return
+		}
+
+		d, err := ws.findDevice(r.Context(), installation, name)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), deviceContextKey{}, d)))
+	})
+}
+
+// requestDevice returns the device addressed by the request, the default one for /api/vent routes.
+func (ws *WebServer) requestDevice(r *http.Request) (device, error) {
+	if d, ok := r.Context().Value(deviceContextKey{}).(device); ok {
+		return d, nil
+	}
+	return ws.defaultDevice()
+}
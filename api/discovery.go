@@ -0,0 +1,33 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (ws *WebServer) apiInstallations(w http.ResponseWriter, r *http.Request) {
+	installations, err := ws.sessions.Installations(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, installations)
+}
+
+func (ws *WebServer) apiInstallationComponents(w http.ResponseWriter, r *http.Request) {
+	installation, err := url.PathUnescape(chi.URLParam(r, "installation"))
+	if err != nil {
+		writeError(w, fmt.Errorf("%w: installation: %w", errInvalidRequest, err))
+		return
+	}
+
+	components, err := ws.sessions.Components(r.Context(), installation)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, components)
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+	"github.com/mtojek/spiroflex-vent-clear/boost"
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+	"github.com/mtojek/spiroflex-vent-clear/scheduler"
+)
+
+// Error codes in API responses, so clients don't need to parse messages.
+const (
+	codeInvalidRequest  = "invalid_request"
+	codeUnauthenticated = "unauthenticated"
+	codeForbidden       = "forbidden"
+	codeNotFound        = "not_found"
+	codeConflict        = "conflict"
+	codeAuthFailed      = "auth_failed"
+	codeDeviceRejected  = "device_rejected"
+	codeDeviceOffline   = "device_offline"
+	codeUnavailable     = "unavailable"
+	codeTimeout         = "timeout"
+	codeInternal        = "internal"
+)
+
+var errInvalidRequest = errors.New("invalid request")
+
+// apiError describes how an error is reported to clients.
+type apiError struct {
+	status int
+	code   string
+	// speech is the spoken message of the Alexa skill.
+	speech string
+}
+
+func classifyError(err error) apiError {
+	var statusErr *econet.StatusError
+	switch {
+	case errors.Is(err, errUnauthenticated), errors.Is(err, errInvalidCreds):
+		return apiError{http.StatusUnauthorized, codeUnauthenticated, "Sorry! You're not authorized."}
+	case errors.Is(err, errForbidden), errors.Is(err, spiroflex.ErrNotAllowed):
+		return apiError{http.StatusForbidden, codeForbidden, "Sorry! This isn't allowed."}
+	case errors.Is(err, errInvalidRequest), errors.Is(err, econet.ErrInvalidValue),
+		errors.Is(err, econet.ErrNoParams), errors.Is(err, econet.ErrUnconfirmedWrite), errors.Is(err, scheduler.ErrInvalid):
+		return apiError{http.StatusBadRequest, codeInvalidRequest, "Sorry! I didn't understand your request."}
+	case errors.Is(err, errNoDevices), errors.Is(err, spiroflex.ErrNotConfigured),
+		errors.Is(err, econet.ErrInstallationNotFound), errors.Is(err, econet.ErrComponentNotFound), errors.Is(err, scheduler.ErrNotFound):
+		return apiError{http.StatusNotFound, codeNotFound, "Sorry! I can't find this device."}
+	case errors.Is(err, boost.ErrNotActive):
+		return apiError{http.StatusConflict, codeConflict, "There's no boost to cancel."}
+	case errors.Is(err, econet.ErrAmbiguousComponent):
+		return apiError{http.StatusConflict, codeConflict, "Sorry! Several devices have this name, please check the configuration."}
+	case errors.Is(err, econet.ErrAuthFailed):
+		return apiError{http.StatusBadGateway, codeAuthFailed, "Sorry! I can't sign in to the ecoNET cloud, please check the account."}
+	case errors.As(err, &statusErr):
+		return apiError{http.StatusBadGateway, codeDeviceRejected, "Sorry! The device rejected the change."}
+	case errors.Is(err, econet.ErrDeviceOffline):
+		return apiError{http.StatusServiceUnavailable, codeDeviceOffline, "Sorry! The device is offline."}
+	case errors.Is(err, econet.ErrNotConnected), errors.Is(err, econet.ErrConnectionLost),
+		errors.Is(err, econet.ErrDraining), errors.Is(err, econet.ErrShutdown):
+		return apiError{http.StatusServiceUnavailable, codeUnavailable, "Sorry! I can't reach the device right now, please try again."}
+	case errors.Is(err, econet.ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return apiError{http.StatusGatewayTimeout, codeTimeout, "Sorry! The device didn't respond in time."}
+	}
+	return apiError{http.StatusInternalServerError, codeInternal, "Sorry! Something went wrong."}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+	"github.com/mtojek/spiroflex-vent-clear/scheduler"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err          error
+		expectedCode int
+	}{
+		{err: errors.New("unexpected"), expectedCode: http.StatusInternalServerError},
+		{err: errUnauthenticated, expectedCode: http.StatusUnauthorized},
+		{err: errForbidden, expectedCode: http.StatusForbidden},
+		{err: fmt.Errorf("writing parameter u1 is %w", spiroflex.ErrNotAllowed), expectedCode: http.StatusForbidden},
+		{err: fmt.Errorf("%w body: EOF", errInvalidRequest), expectedCode: http.StatusBadRequest},
+		{err: fmt.Errorf("unable to modify: %w", econet.ErrInvalidValue), expectedCode: http.StatusBadRequest},
+		{err: fmt.Errorf("%w rule: rule must have days", scheduler.ErrInvalid), expectedCode: http.StatusBadRequest},
+		{err: fmt.Errorf("device Kitchen is %w", spiroflex.ErrNotConfigured), expectedCode: http.StatusNotFound},
+		{err: fmt.Errorf("%w: Home", econet.ErrInstallationNotFound), expectedCode: http.StatusNotFound},
+		{err: fmt.Errorf("%w: Cognito authentication failed", econet.ErrAuthFailed), expectedCode: http.StatusBadGateway},
+		{err: fmt.Errorf("unable to modify: %w", &econet.StatusError{Operation: "params modification", StatusCode: 2}), expectedCode: http.StatusBadGateway},
+		{err: fmt.Errorf("%w: installation Home", econet.ErrDeviceOffline), expectedCode: http.StatusServiceUnavailable},
+		{err: econet.ErrNotConnected, expectedCode: http.StatusServiceUnavailable},
+		{err: fmt.Errorf("%w, transaction ID: 1, error: %w", econet.ErrTimeout, context.DeadlineExceeded), expectedCode: http.StatusGatewayTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			if e := classifyError(tt.err); e.status != tt.expectedCode {
+				t.Errorf("expected status %d, got %d (%s)", tt.expectedCode, e.status, e.code)
+			}
+		})
+	}
+}
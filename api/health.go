@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// readyTimeout limits readiness checks, which may authenticate and connect to installations.
+	readyTimeout = 10 * time.Second
+	// readyTTL is how long the result of readiness checks is reused, so probes don't hit the cloud.
+	readyTTL = 10 * time.Second
+	// readyMaxBackoff limits how long a failed result is reused, the period doubles with
+	// every failure, so failing credentials don't cause a login on every probe.
+	readyMaxBackoff = 5 * time.Minute
+)
+
+type check struct {
+	Name string `json:"name"`
+	Ok   bool   `json:"ok"`
+}
+
+type readiness struct {
+	Ready  bool    `json:"ready"`
+	Checks []check `json:"checks"`
+}
+
+// readinessCache keeps the result of the last readiness checks.
+type readinessCache struct {
+	calls singleflight.Group
+
+	m        sync.Mutex
+	result   readiness
+	until    time.Time
+	failures int
+}
+
+// healthz reports the process is alive.
+func (ws *WebServer) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	writeSuccess(w)
+}
+
+// readyz reports whether the Cognito credentials are valid, MQTT sessions of installations
+// are connected and the configured devices are found on their buses. The endpoint isn't
+// authenticated, so it returns only names of the checks and whether they passed.
+func (ws *WebServer) readyz(w http.ResponseWriter, r *http.Request) {
+	resp := ws.readiness()
+
+	status := http.StatusOK
+	if !resp.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// readiness returns the cached result of readiness checks, running them if it's outdated.
+// Concurrent probes share the checks.
+func (ws *WebServer) readiness() readiness {
+	c := &ws.ready
+	c.m.Lock()
+	if time.Now().Before(c.until) {
+		defer c.m.Unlock()
+		return c.result
+	}
+	c.m.Unlock()
+
+	v, _, _ := c.calls.Do("readyz", func() (any, error) {
+		resp := ws.checkReadiness()
+
+		c.m.Lock()
+		defer c.m.Unlock()
+
+		ttl := readyTTL
+		if resp.Ready {
+			c.failures = 0
+		} else {
+			ttl = min(readyTTL<<c.failures, readyMaxBackoff)
+			if ttl < readyMaxBackoff {
+				c.failures++
+			}
+		}
+		c.result, c.until = resp, time.Now().Add(ttl)
+		return resp, nil
+	})
+	return v.(readiness)
+}
+
+func (ws *WebServer) checkReadiness() readiness {
+	// Checks aren't bound to the probe, which may go away before the results are cached.
+	ctx, cancel := context.WithTimeout(context.Background(), readyTimeout)
+	defer cancel()
+
+	resp := readiness{Ready: true, Checks: []check{}}
+	add := func(name string, err error) {
+		if err != nil {
+			slog.Warn("Readiness check failed", "check", name, "error", err)
+			resp.Ready = false
+		}
+		resp.Checks = append(resp.Checks, check{Name: name, Ok: err == nil})
+	}
+
+	add("cognito", ws.sessions.CheckCredentials(ctx))
+	// Devices can't be reached without credentials.
+	if resp.Ready {
+		for _, d := range ws.devices {
+			add("device "+d.Name, ws.checkDevice(ctx, d))
+		}
+	}
+	return resp
+}
+
+func (ws *WebServer) checkDevice(ctx context.Context, d device) error {
+	session, _, err := ws.prepareEconet(ctx, d)
+	if err != nil {
+		return err
+	}
+	if !session.IsConnected() {
+		return econet.ErrNotConnected
+	}
+	return nil
+}
+
+func (ws *WebServer) debugEconet(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, ws.sessions.Diagnostics())
+}
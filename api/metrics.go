@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/mtojek/spiroflex-vent-clear/metrics"
+)
+
+// instrument records requests and their latencies by route pattern, so URL parameters
+// like device names don't create separate series.
+func instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		metrics.HTTPRequests.WithLabelValues(routePattern(r), r.Method, strconv.Itoa(status(ww))).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(routePattern(r), r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// routePattern returns the matched route, it's known once the request is routed.
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		return rctx.RoutePattern()
+	}
+	return "unmatched"
+}
+
+func status(ww middleware.WrapResponseWriter) int {
+	if ww.Status() == 0 {
+		return http.StatusOK
+	}
+	return ww.Status()
+}
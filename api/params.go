@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+)
+
+func (ws *WebServer) rawParams(ctx context.Context, d device, ids []string) (econet.Values, error) {
+	session, targetComponentID, err := ws.prepareEconet(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := session.GetRawValues(ctx, targetComponentID, ws.c.RawParams, ids...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read parameters: %w", err)
+	}
+	return values, nil
+}
+
+func (ws *WebServer) setRawParams(ctx context.Context, d device, values econet.Values, confirm bool) error {
+	session, targetComponentID, err := ws.prepareEconet(ctx, d)
+	if err != nil {
+		return err
+	}
+
+	err = session.SetRawValues(ctx, targetComponentID, ws.c.RawParams, values, confirm)
+	if err != nil {
+		return fmt.Errorf("unable to modify parameters: %w", err)
+	}
+	return nil
+}
+
+func (ws *WebServer) apiVentParams(w http.ResponseWriter, r *http.Request) {
+	d, err := ws.requestDevice(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var ids []string
+	for _, v := range r.URL.Query()["ids"] {
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	values, err := ws.rawParams(r.Context(), d, ids)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, values)
+}
+
+func (ws *WebServer) apiVentSetParams(w http.ResponseWriter, r *http.Request) {
+	d, err := ws.requestDevice(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req struct {
+		Values  econet.Values `json:"values"`
+		Confirm bool          `json:"confirm"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, fmt.Errorf("%w body: %w", errInvalidRequest, err))
+		return
+	}
+
+	err = ws.setRawParams(r.Context(), d, req.Values, req.Confirm)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeSuccess(w)
+}
@@ -2,9 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/mtojek/spiroflex-vent-clear/boost"
 )
 
 func (ws *WebServer) index(w http.ResponseWriter, r *http.Request) {
@@ -13,8 +16,14 @@ func (ws *WebServer) index(w http.ResponseWriter, r *http.Request) {
 }
 
 func (ws *WebServer) apiVentLevel(w http.ResponseWriter, r *http.Request) {
+	d, err := ws.requestDevice(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
 	level := chi.URLParam(r, "level")
-	err := ws.ventLevel(r.Context(), level)
+	err = ws.ventLevel(r.Context(), d, level)
 	if err != nil {
 		writeError(w, err)
 		return
@@ -23,7 +32,13 @@ func (ws *WebServer) apiVentLevel(w http.ResponseWriter, r *http.Request) {
 }
 
 func (ws *WebServer) apiVentPause(w http.ResponseWriter, r *http.Request) {
-	err := ws.ventPause(r.Context())
+	d, err := ws.requestDevice(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = ws.ventPause(r.Context(), d)
 	if err != nil {
 		writeError(w, err)
 		return
@@ -32,8 +47,14 @@ func (ws *WebServer) apiVentPause(w http.ResponseWriter, r *http.Request) {
 }
 
 func (ws *WebServer) apiVentMode(w http.ResponseWriter, r *http.Request) {
+	d, err := ws.requestDevice(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
 	mode := chi.URLParam(r, "mode")
-	err := ws.ventMode(r.Context(), mode)
+	err = ws.ventMode(r.Context(), d, mode)
 	if err != nil {
 		writeError(w, err)
 		return
@@ -42,8 +63,82 @@ func (ws *WebServer) apiVentMode(w http.ResponseWriter, r *http.Request) {
 }
 
 func (ws *WebServer) apiVentPower(w http.ResponseWriter, r *http.Request) {
+	d, err := ws.requestDevice(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
 	state := chi.URLParam(r, "state")
-	err := ws.ventPower(r.Context(), state)
+	err = ws.ventPower(r.Context(), d, state)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeSuccess(w)
+}
+
+func (ws *WebServer) apiVentStatus(w http.ResponseWriter, r *http.Request) {
+	d, err := ws.requestDevice(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	status, err := ws.ventStatus(r.Context(), d)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, status)
+}
+
+func (ws *WebServer) apiVentSchedule(w http.ResponseWriter, r *http.Request) {
+	d, err := ws.requestDevice(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	schedule, err := ws.ventSchedule(r.Context(), d)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, schedule)
+}
+
+func (ws *WebServer) apiVentBoost(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Level   string `json:"level"`
+		Minutes int    `json:"minutes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, fmt.Errorf("%w body: %w", errInvalidRequest, err))
+		return
+	}
+
+	state, err := ws.ventBoost(r.Context(), req.Level, time.Duration(req.Minutes)*time.Minute)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, state)
+}
+
+func (ws *WebServer) apiVentBoostStatus(w http.ResponseWriter, r *http.Request) {
+	state := ws.booster.Status()
+	writeJSON(w, struct {
+		Active bool         `json:"active"`
+		Boost  *boost.State `json:"boost,omitempty"`
+	}{
+		Active: state != nil,
+		Boost:  state,
+	})
+}
+
+func (ws *WebServer) apiVentBoostCancel(w http.ResponseWriter, r *http.Request) {
+	err := ws.booster.Cancel(r.Context())
 	if err != nil {
 		writeError(w, err)
 		return
@@ -52,8 +147,10 @@ func (ws *WebServer) apiVentPower(w http.ResponseWriter, r *http.Request) {
 }
 
 func writeError(w http.ResponseWriter, err error) {
-	resp := response{Error: err.Error()}
-	w.WriteHeader(http.StatusInternalServerError)
+	e := classifyError(err)
+	resp := response{Error: err.Error(), Code: e.code}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.status)
 	json.NewEncoder(w).Encode(resp)
 }
 
@@ -62,3 +159,9 @@ func writeSuccess(w http.ResponseWriter) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(resp)
 }
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(v)
+}
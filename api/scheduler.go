@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mtojek/spiroflex-vent-clear/scheduler"
+)
+
+const defaultPreviewTransitions = 10
+
+func (ws *WebServer) apiSchedulerRules(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, ws.scheduler.Rules())
+}
+
+func (ws *WebServer) apiSchedulerRule(w http.ResponseWriter, r *http.Request) {
+	rule, err := ws.scheduler.Rule(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, rule)
+}
+
+func (ws *WebServer) apiSchedulerAddRule(w http.ResponseWriter, r *http.Request) {
+	var rule scheduler.Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeError(w, fmt.Errorf("%w body: %w", errInvalidRequest, err))
+		return
+	}
+
+	added, err := ws.scheduler.AddRule(rule)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, added)
+}
+
+func (ws *WebServer) apiSchedulerUpdateRule(w http.ResponseWriter, r *http.Request) {
+	var rule scheduler.Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeError(w, fmt.Errorf("%w body: %w", errInvalidRequest, err))
+		return
+	}
+
+	updated, err := ws.scheduler.UpdateRule(chi.URLParam(r, "id"), rule)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, updated)
+}
+
+func (ws *WebServer) apiSchedulerDeleteRule(w http.ResponseWriter, r *http.Request) {
+	err := ws.scheduler.DeleteRule(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeSuccess(w)
+}
+
+func (ws *WebServer) apiSchedulerOverrides(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, ws.scheduler.Overrides())
+}
+
+func (ws *WebServer) apiSchedulerAddOverride(w http.ResponseWriter, r *http.Request) {
+	var override scheduler.Override
+	if err := json.NewDecoder(r.Body).Decode(&override); err != nil {
+		writeError(w, fmt.Errorf("%w body: %w", errInvalidRequest, err))
+		return
+	}
+
+	added, err := ws.scheduler.AddOverride(override)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, added)
+}
+
+func (ws *WebServer) apiSchedulerDeleteOverride(w http.ResponseWriter, r *http.Request) {
+	err := ws.scheduler.DeleteOverride(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeSuccess(w)
+}
+
+func (ws *WebServer) apiSchedulerPreview(w http.ResponseWriter, r *http.Request) {
+	n := defaultPreviewTransitions
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		n, err = strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, fmt.Errorf("%w: invalid number of transitions: %s", errInvalidRequest, v))
+			return
+		}
+	}
+	writeJSON(w, ws.scheduler.Preview(n))
+}
@@ -0,0 +1,400 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	smartHomeEndpointID = "spiroflex-vent"
+
+	rangeInstance = "Fan.Level"
+	modeInstance  = "Vent.Mode"
+
+	modeSchedule = "Mode.Schedule"
+	modeManual   = "Mode.Manual"
+)
+
+type directiveHeader struct {
+	Namespace        string `json:"namespace"`
+	Name             string `json:"name"`
+	PayloadVersion   string `json:"payloadVersion"`
+	MessageID        string `json:"messageId"`
+	CorrelationToken string `json:"correlationToken,omitempty"`
+	Instance         string `json:"instance,omitempty"`
+}
+
+type directiveScope struct {
+	Type  string `json:"type"`
+	Token string `json:"token"`
+}
+
+type directiveEndpoint struct {
+	EndpointID string          `json:"endpointId"`
+	Scope      *directiveScope `json:"scope,omitempty"`
+}
+
+type directive struct {
+	Directive struct {
+		Header   directiveHeader    `json:"header"`
+		Endpoint *directiveEndpoint `json:"endpoint,omitempty"`
+		Payload  json.RawMessage    `json:"payload"`
+	} `json:"directive"`
+}
+
+type eventProperty struct {
+	Namespace                 string `json:"namespace"`
+	Instance                  string `json:"instance,omitempty"`
+	Name                      string `json:"name"`
+	Value                     any    `json:"value"`
+	TimeOfSample              string `json:"timeOfSample"`
+	UncertaintyInMilliseconds int    `json:"uncertaintyInMilliseconds"`
+}
+
+type event struct {
+	Event struct {
+		Header   directiveHeader    `json:"header"`
+		Endpoint *directiveEndpoint `json:"endpoint,omitempty"`
+		Payload  any                `json:"payload"`
+	} `json:"event"`
+	Context *struct {
+		Properties []eventProperty `json:"properties"`
+	} `json:"context,omitempty"`
+}
+
+type smartHomeError struct {
+	errorType string
+	err       error
+}
+
+func (e *smartHomeError) Error() string {
+	return e.err.Error()
+}
+
+func invalidValue(format string, args ...any) error {
+	return &smartHomeError{errorType: "INVALID_VALUE", err: fmt.Errorf(format, args...)}
+}
+
+func (ws *WebServer) smartHome(w http.ResponseWriter, r *http.Request) {
+	var d directive
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		http.Error(w, "invalid directive: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	header := d.Directive.Header
+	slog.Info("Alexa Smart Home directive", "namespace", header.Namespace, "name", header.Name)
+
+	switch header.Namespace + "." + header.Name {
+	case "Alexa.Discovery.Discover":
+		// Alexa rejects null endpoints.
+		endpoints := []any{}
+		for _, d := range ws.devices {
+			endpoints = append(endpoints, ws.smartHomeEndpoint(d))
+		}
+		writeSmartHomeEvent(w, header, "Alexa.Discovery", "Discover.Response", nil, map[string]any{
+			"endpoints": endpoints,
+		}, nil)
+		return
+	case "Alexa.Authorization.AcceptGrant":
+		writeSmartHomeEvent(w, header, "Alexa.Authorization", "AcceptGrant.Response", nil, map[string]any{}, nil)
+		return
+	}
+
+	ctx := r.Context()
+	dev, err := ws.smartHomeDevice(d.Directive.Endpoint)
+	if err != nil {
+		writeSmartHomeError(w, header, d.Directive.Endpoint, err)
+		return
+	}
+
+	switch header.Namespace + "." + header.Name {
+	case "Alexa.ReportState":
+		status, err := ws.ventStatus(ctx, dev)
+		if err != nil {
+			writeSmartHomeError(w, header, d.Directive.Endpoint, err)
+			return
+		}
+		writeSmartHomeEvent(w, header, "Alexa", "StateReport", d.Directive.Endpoint, map[string]any{}, status)
+		return
+	case "Alexa.PowerController.TurnOn":
+		err = ws.ventPower(ctx, dev, "on")
+	case "Alexa.PowerController.TurnOff":
+		err = ws.ventPower(ctx, dev, "off")
+	case "Alexa.RangeController.SetRangeValue":
+		var payload struct {
+			RangeValue int `json:"rangeValue"`
+		}
+		if err = json.Unmarshal(d.Directive.Payload, &payload); err == nil {
+			err = ws.ventRange(ctx, dev, payload.RangeValue)
+		}
+	case "Alexa.RangeController.AdjustRangeValue":
+		var payload struct {
+			RangeValueDelta int `json:"rangeValueDelta"`
+		}
+		if err = json.Unmarshal(d.Directive.Payload, &payload); err == nil {
+			err = ws.adjustVentRange(ctx, dev, payload.RangeValueDelta)
+		}
+	case "Alexa.ModeController.SetMode":
+		var payload struct {
+			Mode string `json:"mode"`
+		}
+		if err = json.Unmarshal(d.Directive.Payload, &payload); err == nil {
+			switch payload.Mode {
+			case modeSchedule:
+				err = ws.ventMode(ctx, dev, "schedule")
+			case modeManual:
+				err = ws.ventMode(ctx, dev, "manual")
+			default:
+				err = invalidValue("unsupported mode: %s", payload.Mode)
+			}
+		}
+	default:
+		err = &smartHomeError{
+			errorType: "INVALID_DIRECTIVE",
+			err:       fmt.Errorf("unsupported directive: %s.%s", header.Namespace, header.Name),
+		}
+	}
+
+	if err != nil {
+		writeSmartHomeError(w, header, d.Directive.Endpoint, err)
+		return
+	}
+
+	status, err := ws.ventStatus(ctx, dev)
+	if err != nil {
+		slog.Warn("Alexa Smart Home response will not contain state", "error", err)
+		status = nil
+	}
+	writeSmartHomeEvent(w, header, "Alexa", "Response", d.Directive.Endpoint, map[string]any{}, status)
+}
+
+// ventRange sets the fan level, where 0 pauses the ventilation.
+func (ws *WebServer) ventRange(ctx context.Context, d device, value int) error {
+	if value < 0 || value > 3 {
+		return invalidValue("range value must be between 0 and 3")
+	}
+	if value == 0 {
+		return ws.ventPause(ctx, d)
+	}
+	return ws.ventLevel(ctx, d, strconv.Itoa(value))
+}
+
+func (ws *WebServer) adjustVentRange(ctx context.Context, d device, delta int) error {
+	status, err := ws.ventStatus(ctx, d)
+	if err != nil {
+		return err
+	}
+
+	current, ok := rangeValue(status)
+	if !ok {
+		return fmt.Errorf("unknown current level: %s", status.Level)
+	}
+	return ws.ventRange(ctx, d, min(max(current+delta, 0), 3))
+}
+
+func rangeValue(status *ventStatus) (int, bool) {
+	if status.Level == "pause" {
+		return 0, true
+	}
+
+	level, err := strconv.Atoi(status.Level)
+	return level, err == nil
+}
+
+// smartHomeEndpointID identifies the device in Alexa, the default device keeps the ID
+// used before multiple devices were supported.
+func (ws *WebServer) smartHomeEndpointID(d device) string {
+	if def, _ := ws.defaultDevice(); d == def {
+		return smartHomeEndpointID
+	}
+
+	sum := sha256.Sum256([]byte(d.installation + "/" + d.Component))
+	return smartHomeEndpointID + "-" + hex.EncodeToString(sum[:6])
+}
+
+func (ws *WebServer) smartHomeDevice(endpoint *directiveEndpoint) (device, error) {
+	if endpoint == nil {
+		return ws.defaultDevice()
+	}
+
+	for _, d := range ws.devices {
+		if ws.smartHomeEndpointID(d) == endpoint.EndpointID {
+			return d, nil
+		}
+	}
+	return device{}, &smartHomeError{
+		errorType: "NO_SUCH_ENDPOINT",
+		err:       fmt.Errorf("unknown endpoint: %s", endpoint.EndpointID),
+	}
+}
+
+func (ws *WebServer) smartHomeEndpoint(d device) map[string]any {
+	friendlyName := func(text string) map[string]any {
+		return map[string]any{
+			"friendlyNames": []any{
+				map[string]any{"@type": "text", "value": map[string]any{"text": text, "locale": "en-US"}},
+			},
+		}
+	}
+
+	return map[string]any{
+		"endpointId":        ws.smartHomeEndpointID(d),
+		"manufacturerName":  "Spiroflex",
+		"friendlyName":      d.Name,
+		"description":       "Spiroflex Vent Clear ventilation in " + d.installation,
+		"displayCategories": []string{"FAN"},
+		"capabilities": []any{
+			map[string]any{
+				"type":      "AlexaInterface",
+				"interface": "Alexa",
+				"version":   "3",
+			},
+			map[string]any{
+				"type":      "AlexaInterface",
+				"interface": "Alexa.PowerController",
+				"version":   "3",
+				"properties": map[string]any{
+					"supported":           []any{map[string]any{"name": "powerState"}},
+					"proactivelyReported": false,
+					"retrievable":         true,
+				},
+			},
+			map[string]any{
+				"type":      "AlexaInterface",
+				"interface": "Alexa.RangeController",
+				"version":   "3",
+				"instance":  rangeInstance,
+				"capabilityResources": map[string]any{
+					"friendlyNames": []any{
+						map[string]any{"@type": "asset", "value": map[string]any{"assetId": "Alexa.Setting.FanSpeed"}},
+					},
+				},
+				"properties": map[string]any{
+					"supported":           []any{map[string]any{"name": "rangeValue"}},
+					"proactivelyReported": false,
+					"retrievable":         true,
+				},
+				"configuration": map[string]any{
+					"supportedRange": map[string]any{"minimumValue": 0, "maximumValue": 3, "precision": 1},
+					"presets": []any{
+						map[string]any{"rangeValue": 0, "presetResources": friendlyName("pause")},
+						map[string]any{"rangeValue": 1, "presetResources": friendlyName("low")},
+						map[string]any{"rangeValue": 2, "presetResources": friendlyName("medium")},
+						map[string]any{"rangeValue": 3, "presetResources": friendlyName("high")},
+					},
+				},
+			},
+			map[string]any{
+				"type":                "AlexaInterface",
+				"interface":           "Alexa.ModeController",
+				"version":             "3",
+				"instance":            modeInstance,
+				"capabilityResources": friendlyName("mode"),
+				"properties": map[string]any{
+					"supported":           []any{map[string]any{"name": "mode"}},
+					"proactivelyReported": false,
+					"retrievable":         true,
+				},
+				"configuration": map[string]any{
+					"ordered": false,
+					"supportedModes": []any{
+						map[string]any{"value": modeSchedule, "modeResources": friendlyName("schedule")},
+						map[string]any{"value": modeManual, "modeResources": friendlyName("manual")},
+					},
+				},
+			},
+		},
+	}
+}
+
+func smartHomeProperties(status *ventStatus) []eventProperty {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	var properties []eventProperty
+	switch status.Power {
+	case "on":
+		properties = append(properties, eventProperty{Namespace: "Alexa.PowerController", Name: "powerState", Value: "ON", TimeOfSample: now})
+	case "off":
+		properties = append(properties, eventProperty{Namespace: "Alexa.PowerController", Name: "powerState", Value: "OFF", TimeOfSample: now})
+	}
+
+	if value, ok := rangeValue(status); ok {
+		properties = append(properties, eventProperty{Namespace: "Alexa.RangeController", Instance: rangeInstance, Name: "rangeValue", Value: value, TimeOfSample: now})
+	}
+
+	switch status.Mode {
+	case "schedule":
+		properties = append(properties, eventProperty{Namespace: "Alexa.ModeController", Instance: modeInstance, Name: "mode", Value: modeSchedule, TimeOfSample: now})
+	case "manual":
+		properties = append(properties, eventProperty{Namespace: "Alexa.ModeController", Instance: modeInstance, Name: "mode", Value: modeManual, TimeOfSample: now})
+	}
+	return properties
+}
+
+func writeSmartHomeEvent(w http.ResponseWriter, directive directiveHeader, namespace, name string, endpoint *directiveEndpoint, payload any, status *ventStatus) {
+	var e event
+	e.Event.Header = directiveHeader{
+		Namespace:        namespace,
+		Name:             name,
+		PayloadVersion:   "3",
+		MessageID:        newMessageID(),
+		CorrelationToken: directive.CorrelationToken,
+	}
+	if endpoint != nil {
+		e.Event.Endpoint = &directiveEndpoint{EndpointID: endpoint.EndpointID}
+	}
+	e.Event.Payload = payload
+
+	if status != nil {
+		e.Context = &struct {
+			Properties []eventProperty `json:"properties"`
+		}{
+			Properties: smartHomeProperties(status),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(e)
+}
+
+func writeSmartHomeError(w http.ResponseWriter, directive directiveHeader, endpoint *directiveEndpoint, err error) {
+	slog.Warn("Alexa Smart Home directive failed", "namespace", directive.Namespace, "name", directive.Name, "error", err)
+
+	var errorType string
+	if she, ok := err.(*smartHomeError); ok {
+		errorType = she.errorType
+	} else {
+		switch classifyError(err).code {
+		case codeInvalidRequest:
+			errorType = "INVALID_VALUE"
+		case codeNotFound:
+			errorType = "NO_SUCH_ENDPOINT"
+		case codeDeviceRejected:
+			errorType = "HARDWARE_MALFUNCTION"
+		case codeAuthFailed, codeInternal:
+			errorType = "INTERNAL_ERROR"
+		default:
+			errorType = "ENDPOINT_UNREACHABLE"
+		}
+	}
+
+	writeSmartHomeEvent(w, directive, "Alexa", "ErrorResponse", endpoint, map[string]any{
+		"type":    errorType,
+		"message": err.Error(),
+	}, nil)
+}
+
+func newMessageID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+)
+
+func TestSmartHomeDiscoveryWithoutDevices(t *testing.T) {
+	ws := &WebServer{c: &spiroflex.Config{}}
+
+	body := `{"directive":{"header":{"namespace":"Alexa.Discovery","name":"Discover","payloadVersion":"3","messageId":"1"},"payload":{}}}`
+	rec := httptest.NewRecorder()
+	ws.smartHome(rec, httptest.NewRequest(http.MethodPost, "/alexa/smarthome", strings.NewReader(body)))
+
+	var e struct {
+		Event struct {
+			Payload map[string]json.RawMessage `json:"payload"`
+		} `json:"event"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&e); err != nil {
+		t.Fatalf("can't decode event: %v", err)
+	}
+	if endpoints := string(e.Event.Payload["endpoints"]); endpoints != "[]" {
+		t.Errorf("expected empty endpoints, got %s", endpoints)
+	}
+}
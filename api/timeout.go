@@ -0,0 +1,27 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const (
+	// restTimeout bounds device calls of REST requests, including connecting to the installation.
+	restTimeout = 30 * time.Second
+	// alexaTimeout bounds device calls of Alexa requests, so the spoken error is sent before
+	// Alexa gives up waiting for the response.
+	alexaTimeout = 7 * time.Second
+)
+
+// deviceTimeout sets the deadline of device calls made while handling the request.
+func deviceTimeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
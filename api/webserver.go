@@ -1,51 +1,184 @@
 package api
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"path/filepath"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 	"github.com/mtojek/spiroflex-vent-clear"
+	"github.com/mtojek/spiroflex-vent-clear/boost"
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+	"github.com/mtojek/spiroflex-vent-clear/metrics"
+	"github.com/mtojek/spiroflex-vent-clear/scheduler"
 	"github.com/tbuckley/go-alexa"
 )
 
 type WebServer struct {
-	c *spiroflex.Config
+	c              *spiroflex.Config
+	devices        []device
+	authenticators []authenticator
+
+	sessions  *econet.Manager
+	booster   *boost.Booster
+	scheduler *scheduler.Scheduler
+	ready     readinessCache
+
+	cancel        context.CancelFunc
+	schedulerDone chan struct{}
 }
 
 type response struct {
 	Ok    bool   `json:"ok"`
 	Error string `json:"error,omitempty"`
+	Code  string `json:"code,omitempty"`
 }
 
 func NewWebServer(c *spiroflex.Config) *WebServer {
-	return &WebServer{
-		c: c,
+	ws := &WebServer{
+		c:              c,
+		devices:        configuredDevices(c),
+		authenticators: newAuthenticators(c.API.Auth),
+
+		sessions: econet.NewManager(c),
+	}
+
+	if !c.API.Auth.Enabled() {
+		if open := openEndpoints(c.API); len(open) > 0 {
+			slog.Warn("No API clients are configured in api.auth, the endpoints are open to anyone who can reach them", "endpoints", open)
+		}
+	}
+
+	if len(c.DeviceSchedule.Params) > 0 {
+		slog.Warn("Device schedule support is experimental, its encoding hasn't been verified on a real device")
+	}
+
+	ws.booster = boost.New(&vent{ws: ws}, filepath.Join(c.Storage.Dir, "boost.json"))
+	if err := ws.booster.Resume(); err != nil {
+		slog.Error("Boost can't be resumed", "error", err)
+	}
+
+	ws.scheduler = scheduler.New(&scheduledVent{vent{ws: ws}}, filepath.Join(c.Storage.Dir, "scheduler.json"))
+	if err := ws.scheduler.Load(); err != nil {
+		slog.Error("Scheduler rules can't be loaded", "error", err)
 	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ws.cancel = cancel
+	ws.schedulerDone = make(chan struct{})
+	go func() {
+		defer close(ws.schedulerDone)
+		ws.scheduler.Run(ctx)
+	}()
+	return ws
 }
 
 func (ws *WebServer) Handler() http.Handler {
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
+	r.Use(logRequests)
+	r.Use(instrument)
+	r.Use(traceRequests)
 
 	r.Get("/", ws.index)
+	r.Get("/healthz", ws.healthz)
+	r.Get("/readyz", ws.readyz)
 
 	if ws.c.API.Rest {
 		r.Route("/api", func(r chi.Router) {
+			r.Use(ws.requireMethodScope)
+			r.Use(deviceTimeout(restTimeout))
+
 			r.Route("/vent", func(r chi.Router) {
-				r.Post("/level/{level:[1-3]?}", ws.apiVentLevel)
-				r.Post("/pause", ws.apiVentPause)
-				r.Post("/mode/{mode:schedule|manual}", ws.apiVentMode)
-				r.Post("/power/{state:on|off}", ws.apiVentPower)
+				ws.ventRoutes(r)
+
+				r.Get("/boost", ws.apiVentBoostStatus)
+				r.Post("/boost", ws.apiVentBoost)
+				r.Delete("/boost", ws.apiVentBoostCancel)
+			})
+
+			r.Route("/installations", func(r chi.Router) {
+				r.Get("/", ws.apiInstallations)
+				r.Get("/{installation}/components", ws.apiInstallationComponents)
+
+				r.Route("/{installation}/devices/{device}", func(r chi.Router) {
+					r.Use(ws.withDevice)
+					ws.ventRoutes(r)
+				})
+			})
+
+			r.Route("/scheduler", func(r chi.Router) {
+				r.Get("/rules", ws.apiSchedulerRules)
+				r.Post("/rules", ws.apiSchedulerAddRule)
+				r.Get("/rules/{id}", ws.apiSchedulerRule)
+				r.Put("/rules/{id}", ws.apiSchedulerUpdateRule)
+				r.Delete("/rules/{id}", ws.apiSchedulerDeleteRule)
+
+				r.Get("/overrides", ws.apiSchedulerOverrides)
+				r.Post("/overrides", ws.apiSchedulerAddOverride)
+				r.Delete("/overrides/{id}", ws.apiSchedulerDeleteOverride)
+
+				r.Get("/preview", ws.apiSchedulerPreview)
 			})
 		})
 	}
 
 	if ws.c.API.Alexa {
 		skill := alexa.New(ws.c.Alexa.AppID)
-		r.HandleFunc("/alexa", func(w http.ResponseWriter, r *http.Request) {
+		r.With(deviceTimeout(alexaTimeout), verifyAlexaRequest).HandleFunc("/alexa", func(w http.ResponseWriter, r *http.Request) {
 			skill.HandlerFuncWithNext(w, r, ws.alexa)
 		})
 	}
+
+	if ws.c.API.Metrics {
+		r.With(ws.requireScope(spiroflex.ScopeRead)).Get("/metrics", metrics.Handler().ServeHTTP)
+	}
+
+	if ws.c.API.Debug {
+		r.With(ws.requireScope(spiroflex.ScopeRead)).Get("/debug/econet", ws.debugEconet)
+	}
+
+	if ws.c.API.SmartHome {
+		r.With(ws.requireScope(spiroflex.ScopeControl), deviceTimeout(alexaTimeout)).Post("/alexa/smarthome", ws.smartHome)
+	}
 	return r
 }
+
+// ventRoutes registers operations on a device, the default one unless withDevice resolves it.
+func (ws *WebServer) ventRoutes(r chi.Router) {
+	r.Post("/level/{level:[1-3]?}", ws.apiVentLevel)
+	r.Post("/pause", ws.apiVentPause)
+	r.Post("/mode/{mode:schedule|manual}", ws.apiVentMode)
+	r.Post("/power/{state:on|off}", ws.apiVentPower)
+	r.Get("/status", ws.apiVentStatus)
+
+	r.Get("/schedule", ws.apiVentSchedule)
+
+	r.Get("/params", ws.apiVentParams)
+	r.Post("/params", ws.apiVentSetParams)
+}
+
+// Shutdown stops the scheduler and the boost timer, waits for pending transactions until
+// the context is done, and disconnects MQTT sessions. Boosts and scheduler rules are persisted
+// whenever they change, so they're resumed after the restart.
+func (ws *WebServer) Shutdown(ctx context.Context) error {
+	ws.cancel()
+	select {
+	case <-ws.schedulerDone:
+	case <-ctx.Done():
+		slog.Warn("Scheduler is still applying a transition, shutting down anyway")
+	}
+	ws.booster.Stop()
+
+	if err := ws.sessions.Shutdown(ctx); err != nil {
+		return fmt.Errorf("unable to drain MQTT sessions: %w", err)
+	}
+	return nil
+}
+
+func (ws *WebServer) Close() {
+	if err := ws.Shutdown(context.Background()); err != nil {
+		slog.Error("Web server shutdown failed", "error", err)
+	}
+}
@@ -0,0 +1,343 @@
+// Package boost runs the ventilation at a given level for a limited time and restores
+// the previous state afterwards.
+package boost
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+)
+
+const (
+	restoreTimeout    = 30 * time.Second
+	restoreRetryDelay = time.Minute
+	// maxRestoreAttempts limits retries of a failing restore, the boost is dropped afterwards.
+	maxRestoreAttempts = 10
+	// fallbackLevel is restored if the level before the boost isn't valid, e.g. unknown.
+	fallbackLevel = "1"
+)
+
+var ErrNotActive = errors.New("boost is not active")
+
+// Vent is the boosted unit. Its state is read as a Snapshot before the boost and restored afterwards.
+type Vent interface {
+	Status(ctx context.Context) (Snapshot, error)
+	SetLevel(ctx context.Context, level string) error
+	SetMode(ctx context.Context, mode string) error
+	SetPower(ctx context.Context, power string) error
+}
+
+// Snapshot is the state of the unit restored after the boost.
+type Snapshot struct {
+	Level string `json:"level"`
+	Mode  string `json:"mode"`
+	Power string `json:"power"`
+}
+
+type State struct {
+	Level    string    `json:"level"`
+	Started  time.Time `json:"started"`
+	Until    time.Time `json:"until"`
+	Previous Snapshot  `json:"previous"`
+}
+
+type Booster struct {
+	vent Vent
+	path string
+
+	// ops serializes operations on the unit, so a restore doesn't interleave with a new boost.
+	ops sync.Mutex
+
+	// m guards the fields below, it's never held during calls to the unit.
+	m        sync.Mutex
+	state    *State
+	timer    *time.Timer
+	failures int
+}
+
+// New creates the booster persisting its state in the file at path.
+func New(vent Vent, path string) *Booster {
+	return &Booster{
+		vent: vent,
+		path: path,
+	}
+}
+
+// Resume loads the persisted boost and schedules its restore. Expired boosts are restored immediately.
+func (b *Booster) Resume() error {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	data, err := os.ReadFile(b.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("can't read boost state: %w", err)
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("can't unmarshal boost state: %w", err)
+	}
+
+	slog.Info("Resuming boost", "level", state.Level, "until", state.Until.Format(time.RFC3339))
+	b.state = &state
+	b.schedule(time.Until(state.Until))
+	return nil
+}
+
+// Start runs the ventilation at the level for the duration. Starting a boost while another
+// one is active extends it, keeping the state from before the first boost.
+func (b *Booster) Start(ctx context.Context, level string, d time.Duration) (*State, error) {
+	if d <= 0 {
+		return nil, fmt.Errorf("boost duration must be positive")
+	}
+
+	b.ops.Lock()
+	defer b.ops.Unlock()
+
+	b.m.Lock()
+	active := b.state
+	b.m.Unlock()
+
+	var previous Snapshot
+	if active != nil {
+		previous = active.Previous
+	} else {
+		snapshot, err := b.vent.Status(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read state before boost: %w", err)
+		}
+		previous = snapshot
+	}
+
+	if previous.Power != "on" {
+		if err := b.vent.SetPower(ctx, "on"); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.vent.SetLevel(ctx, level); err != nil {
+		return nil, err
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	// The previous state may have been updated by Defer in the meantime.
+	if b.state != nil {
+		previous = b.state.Previous
+	}
+	now := time.Now()
+	state := &State{
+		Level:    level,
+		Started:  now,
+		Until:    now.Add(d),
+		Previous: previous,
+	}
+	if err := b.save(state); err != nil {
+		return nil, err
+	}
+	b.state = state
+	b.failures = 0
+	b.schedule(d)
+
+	s := *state
+	return &s, nil
+}
+
+// Cancel finishes the active boost now and restores the previous state. A boost whose
+// restore keeps failing is dropped without touching the unit.
+func (b *Booster) Cancel(ctx context.Context) error {
+	b.m.Lock()
+	if b.state != nil && b.failures > 0 {
+		slog.Warn("Dropping the boost, its restore failed", "attempts", b.failures)
+		b.finish()
+		b.m.Unlock()
+		return nil
+	}
+	b.m.Unlock()
+
+	b.ops.Lock()
+	defer b.ops.Unlock()
+
+	return b.restore(ctx)
+}
+
+// Defer updates the state restored after the active boost instead of changing the unit,
+// e.g. when a scheduler rule fires during the boost. It reports whether a boost is active.
+func (b *Booster) Defer(update func(previous *Snapshot)) (bool, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.state == nil {
+		return false, nil
+	}
+
+	state := *b.state
+	update(&state.Previous)
+	if err := b.save(&state); err != nil {
+		return true, err
+	}
+	b.state = &state
+	return true, nil
+}
+
+// Status returns the active boost or nil.
+func (b *Booster) Status() *State {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.state == nil {
+		return nil
+	}
+	s := *b.state
+	return &s
+}
+
+// Stop stops the restore timer keeping the persisted state, so the boost can be resumed.
+func (b *Booster) Stop() {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+}
+
+func (b *Booster) schedule(d time.Duration) {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	b.timer = time.AfterFunc(max(d, 0), b.onTimer)
+}
+
+func (b *Booster) onTimer() {
+	b.ops.Lock()
+	defer b.ops.Unlock()
+
+	b.m.Lock()
+	// The boost may have been extended while the timer fired.
+	due := b.state != nil && !time.Now().Before(b.state.Until)
+	b.m.Unlock()
+	if !due {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), restoreTimeout)
+	defer cancel()
+
+	err := b.restore(ctx)
+	if err == nil {
+		return
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.state == nil {
+		return
+	}
+	b.failures++
+	if b.failures >= maxRestoreAttempts {
+		slog.Error("Boost restore failed, giving up", "attempts", b.failures, "error", err)
+		b.finish()
+		return
+	}
+	slog.Error("Boost restore failed", "attempts", b.failures, "retry_in", restoreRetryDelay, "error", err)
+	b.schedule(restoreRetryDelay)
+}
+
+// restore applies the state from before the boost, it must be called with ops locked.
+func (b *Booster) restore(ctx context.Context) error {
+	b.m.Lock()
+	if b.state == nil {
+		b.m.Unlock()
+		return ErrNotActive
+	}
+	previous := b.state.Previous
+	b.m.Unlock()
+
+	for {
+		if err := b.apply(ctx, previous); err != nil {
+			return fmt.Errorf("unable to restore state after boost: %w", err)
+		}
+
+		b.m.Lock()
+		if b.state == nil || b.state.Previous == previous {
+			b.finish()
+			b.m.Unlock()
+			return nil
+		}
+		// Defer changed the state to restore meanwhile.
+		previous = b.state.Previous
+		b.m.Unlock()
+	}
+}
+
+func (b *Booster) apply(ctx context.Context, previous Snapshot) error {
+	slog.Info("Boost finished, restoring the previous state", "level", previous.Level, "mode", previous.Mode, "power", previous.Power)
+
+	var err error
+	if previous.Mode == econet.ParamVentMode.True {
+		err = b.vent.SetMode(ctx, econet.ParamVentMode.True)
+	} else {
+		level := previous.Level
+		if _, err := econet.ParamVentLevel.Encode(level); err != nil {
+			slog.Warn("Level before the boost is invalid, restoring the fallback level", "level", level, "fallback", fallbackLevel)
+			level = fallbackLevel
+		}
+		err = b.vent.SetLevel(ctx, level)
+	}
+	if err == nil && previous.Power == econet.ParamVentPower.False {
+		err = b.vent.SetPower(ctx, econet.ParamVentPower.False)
+	}
+	return err
+}
+
+// finish forgets the boost, it must be called with m locked.
+func (b *Booster) finish() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.state = nil
+	b.failures = 0
+
+	if err := os.Remove(b.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Error("Boost state can't be removed", "error", err)
+	}
+}
+
+func (b *Booster) save(state *State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("can't marshal boost state: %w", err)
+	}
+	return writeFile(b.path, data)
+}
+
+// writeFile replaces the file atomically.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("can't create state directory: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("can't write state file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("can't replace state file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package boost
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeVent struct {
+	m     sync.Mutex
+	state Snapshot
+	calls []string
+	err   error
+}
+
+func (v *fakeVent) Status(ctx context.Context) (Snapshot, error) {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	return v.state, nil
+}
+
+func (v *fakeVent) SetLevel(ctx context.Context, level string) error {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	if v.err != nil {
+		return v.err
+	}
+	v.state.Level = level
+	v.state.Mode = "manual"
+	v.calls = append(v.calls, "level "+level)
+	return nil
+}
+
+func (v *fakeVent) SetMode(ctx context.Context, mode string) error {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	v.state.Mode = mode
+	v.calls = append(v.calls, "mode "+mode)
+	return nil
+}
+
+func (v *fakeVent) SetPower(ctx context.Context, power string) error {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	v.state.Power = power
+	v.calls = append(v.calls, "power "+power)
+	return nil
+}
+
+func (v *fakeVent) fail(err error) {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	v.err = err
+}
+
+func (v *fakeVent) snapshot() (Snapshot, []string) {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	return v.state, append([]string(nil), v.calls...)
+}
+
+func waitInactive(t *testing.T, b *Booster) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for b.Status() != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("boost wasn't restored")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBoostRestore(t *testing.T) {
+	tests := []struct {
+		name          string
+		before        Snapshot
+		expectedCalls []string
+	}{
+		{
+			name:          "schedule mode",
+			before:        Snapshot{Level: "1", Mode: "schedule", Power: "on"},
+			expectedCalls: []string{"level 3", "mode schedule"},
+		},
+		{
+			name:          "manual mode",
+			before:        Snapshot{Level: "2", Mode: "manual", Power: "on"},
+			expectedCalls: []string{"level 3", "level 2"},
+		},
+		{
+			name:          "unknown level",
+			before:        Snapshot{Level: "unknown (7)", Mode: "manual", Power: "on"},
+			expectedCalls: []string{"level 3", "level 1"},
+		},
+		{
+			name:          "powered off",
+			before:        Snapshot{Level: "pause", Mode: "manual", Power: "off"},
+			expectedCalls: []string{"power on", "level 3", "level pause", "power off"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vent := &fakeVent{state: tt.before}
+			b := New(vent, filepath.Join(t.TempDir(), "boost.json"))
+
+			state, err := b.Start(context.Background(), "3", 20*time.Millisecond)
+			if err != nil {
+				t.Fatalf("Start failed: %v", err)
+			}
+			if state.Previous != tt.before {
+				t.Errorf("expected previous state %+v, got %+v", tt.before, state.Previous)
+			}
+
+			waitInactive(t, b)
+			after, calls := vent.snapshot()
+			if !reflect.DeepEqual(calls, tt.expectedCalls) {
+				t.Errorf("expected calls %v, got %v", tt.expectedCalls, calls)
+			}
+			if after.Mode != tt.before.Mode || after.Power != tt.before.Power {
+				t.Errorf("expected restored state %+v, got %+v", tt.before, after)
+			}
+		})
+	}
+}
+
+func TestBoostResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "boost.json")
+	vent := &fakeVent{state: Snapshot{Level: "1", Mode: "schedule", Power: "on"}}
+
+	b := New(vent, path)
+	if _, err := b.Start(context.Background(), "3", time.Hour); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	b.Stop()
+
+	resumed := New(vent, path)
+	if err := resumed.Resume(); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	if state := resumed.Status(); state == nil || state.Level != "3" {
+		t.Fatalf("expected resumed boost, got %+v", state)
+	}
+
+	if err := resumed.Cancel(context.Background()); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	if state, _ := vent.snapshot(); state.Mode != "schedule" {
+		t.Errorf("expected schedule mode after cancel, got %+v", state)
+	}
+	if err := resumed.Cancel(context.Background()); !errors.Is(err, ErrNotActive) {
+		t.Errorf("expected ErrNotActive, got %v", err)
+	}
+
+	again := New(vent, path)
+	if err := again.Resume(); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	if state := again.Status(); state != nil {
+		t.Errorf("expected no boost after cancel, got %+v", state)
+	}
+}
+
+func TestBoostCancelFailingRestore(t *testing.T) {
+	vent := &fakeVent{state: Snapshot{Level: "1", Mode: "manual", Power: "on"}}
+	b := New(vent, filepath.Join(t.TempDir(), "boost.json"))
+
+	if _, err := b.Start(context.Background(), "3", 10*time.Millisecond); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	vent.fail(errors.New("device offline"))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		b.m.Lock()
+		failures := b.failures
+		b.m.Unlock()
+		if failures > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("restore didn't fail")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := b.Cancel(context.Background()); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	if state := b.Status(); state != nil {
+		t.Errorf("expected the failing boost to be dropped, got %+v", state)
+	}
+}
+
+func TestBoostDefer(t *testing.T) {
+	vent := &fakeVent{state: Snapshot{Level: "1", Mode: "manual", Power: "on"}}
+	b := New(vent, filepath.Join(t.TempDir(), "boost.json"))
+
+	if deferred, _ := b.Defer(func(previous *Snapshot) {}); deferred {
+		t.Error("expected no deferral without an active boost")
+	}
+
+	if _, err := b.Start(context.Background(), "3", time.Hour); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	deferred, err := b.Defer(func(previous *Snapshot) { previous.Mode = "schedule" })
+	if !deferred || err != nil {
+		t.Fatalf("expected deferral, got %v, %v", deferred, err)
+	}
+
+	if err := b.Cancel(context.Background()); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	expected := []string{"level 3", "mode schedule"}
+	if _, calls := vent.snapshot(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, calls)
+	}
+}
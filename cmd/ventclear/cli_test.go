@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+)
+
+func runCLI(t *testing.T, stack *offlineStack, args ...string) (int, string, string) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	app := &cli{
+		stdin:  strings.NewReader(""),
+		stdout: &stdout,
+		stderr: &stderr,
+
+		loadConfig: func() (*spiroflex.Config, error) {
+			return stack.c, nil
+		},
+	}
+	code := app.run(args)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCLI(t *testing.T) {
+	stack := startOffline(t)
+
+	tests := []struct {
+		args         []string
+		expectedCode int
+		expectedOut  string
+	}{
+		{args: []string{"power", "on"}, expectedCode: exitOK, expectedOut: "OK"},
+		{args: []string{"level", "-json", "3"}, expectedCode: exitOK, expectedOut: `"ok": true`},
+		{args: []string{"mode", "manual"}, expectedCode: exitOK, expectedOut: "OK"},
+		{args: []string{"status"}, expectedCode: exitOK, expectedOut: "Living room"},
+		{args: []string{"level", "4"}, expectedCode: exitUsage},
+		{args: []string{"level", "pause"}, expectedCode: exitUsage},
+		{args: []string{"status", "-device", "Kitchen"}, expectedCode: exitUsage},
+		{args: []string{"status", "-device", "Attic"}, expectedCode: exitFailure},
+		{args: []string{"unknown"}, expectedCode: exitUsage},
+		{args: []string{"raw", "SCP V", "not json"}, expectedCode: exitUsage},
+		{args: []string{"raw", "SCP V", `[{"name":"GET_COMPONENTS_ON_BUS"}]`}, expectedCode: exitOK, expectedOut: "ecoVENT MINI OEM"},
+		{args: []string{"raw", "SCP V", `[{"name":"PARAMS_MODIFICATION","targets":[{"component":"1","parameters":{"u81":"4"}}]}]`}, expectedCode: exitUsage},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			code, out, stderr := runCLI(t, stack, tt.args...)
+			if code != tt.expectedCode {
+				t.Fatalf("expected exit code %d, got %d, stderr: %s", tt.expectedCode, code, stderr)
+			}
+			if !strings.Contains(out, tt.expectedOut) {
+				t.Errorf("expected output to contain %q, got: %s", tt.expectedOut, out)
+			}
+		})
+	}
+
+	if level := stack.device.Values()[econet.ParamVentLevel.ID]; level != "5" {
+		t.Errorf("expected level 3, got %s", level)
+	}
+}
+
+func TestCLIStatusJSON(t *testing.T) {
+	stack := startOffline(t)
+
+	code, out, stderr := runCLI(t, stack, "status", "-json")
+	if code != exitOK {
+		t.Fatalf("expected exit code %d, got %d, stderr: %s", exitOK, code, stderr)
+	}
+
+	var status deviceStatus
+	if err := json.Unmarshal([]byte(out), &status); err != nil {
+		t.Fatalf("can't decode status: %v", err)
+	}
+	if status.Installation != "SCP V" || status.Device != "Living room" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
+
+func TestCLIParams(t *testing.T) {
+	stack := startOffline(t)
+	stack.c.RawParams = spiroflex.RawParams{Allow: []string{"u81", "u6630"}}
+
+	tests := []struct {
+		args         []string
+		expectedCode int
+		expectedOut  string
+	}{
+		{args: []string{"params", "set", "u81=4"}, expectedCode: exitUsage},
+		{args: []string{"params", "set", "-confirm", "u81"}, expectedCode: exitUsage},
+		{args: []string{"params", "set", "-confirm", "u7074=H1L0"}, expectedCode: exitFailure},
+		{args: []string{"params", "set", "-confirm", "u81=42"}, expectedCode: exitFailure},
+		{args: []string{"params", "set", "-confirm", "u81=4"}, expectedCode: exitOK, expectedOut: "OK"},
+		{args: []string{"params", "get", "u81", "u6630"}, expectedCode: exitOK, expectedOut: "level  2"},
+		{args: []string{"params", "get", "-json", "u81"}, expectedCode: exitOK, expectedOut: `"u81": "4"`},
+		{args: []string{"params", "get", "u7074"}, expectedCode: exitFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			code, out, stderr := runCLI(t, stack, tt.args...)
+			if code != tt.expectedCode {
+				t.Fatalf("expected exit code %d, got %d, stderr: %s", tt.expectedCode, code, stderr)
+			}
+			if !strings.Contains(out, tt.expectedOut) {
+				t.Errorf("expected output to contain %q, got: %s", tt.expectedOut, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+)
+
+// oneOf checks that the single argument is one of the values.
+func oneOf(values ...string) func(args []string) error {
+	return func(args []string) error {
+		if err := exactArgs(1)(args); err != nil {
+			return err
+		}
+		if !slices.Contains(values, args[0]) {
+			return fmt.Errorf("invalid value %s, expected one of: %s", args[0], strings.Join(values, ", "))
+		}
+		return nil
+	}
+}
+
+type deviceStatus struct {
+	Installation string `json:"installation"`
+	Device       string `json:"device"`
+	Level        string `json:"level"`
+	Mode         string `json:"mode"`
+	Power        string `json:"power"`
+}
+
+// withDevice connects to the installation of the device selected by the -device flag.
+func withDevice(ctx context.Context, c *spiroflex.Config, opts options, f func(session *econet.MQTTSession, componentID string) error) error {
+	installation, d, err := c.LookupDevice(opts.device)
+	if err != nil {
+		return &usageError{err: err}
+	}
+
+	m := econet.NewManager(c)
+	defer m.Close()
+
+	session, componentID, err := m.Target(ctx, installation, d)
+	if err != nil {
+		return err
+	}
+	return f(session, componentID)
+}
+
+func runLevel(ctx context.Context, cli *cli, c *spiroflex.Config, opts options, args []string) error {
+	return withDevice(ctx, c, opts, func(session *econet.MQTTSession, componentID string) error {
+		if err := session.VentLevel(ctx, componentID, args[0]); err != nil {
+			return fmt.Errorf("unable to modify parameters: %w", err)
+		}
+		return cli.printSuccess(opts)
+	})
+}
+
+func runPause(ctx context.Context, cli *cli, c *spiroflex.Config, opts options, args []string) error {
+	return withDevice(ctx, c, opts, func(session *econet.MQTTSession, componentID string) error {
+		if err := session.VentPause(ctx, componentID); err != nil {
+			return fmt.Errorf("unable to modify parameters: %w", err)
+		}
+		return cli.printSuccess(opts)
+	})
+}
+
+func runMode(ctx context.Context, cli *cli, c *spiroflex.Config, opts options, args []string) error {
+	return withDevice(ctx, c, opts, func(session *econet.MQTTSession, componentID string) error {
+		if err := session.VentMode(ctx, componentID, args[0]); err != nil {
+			return fmt.Errorf("unable to modify parameters: %w", err)
+		}
+		return cli.printSuccess(opts)
+	})
+}
+
+func runPower(ctx context.Context, cli *cli, c *spiroflex.Config, opts options, args []string) error {
+	return withDevice(ctx, c, opts, func(session *econet.MQTTSession, componentID string) error {
+		if err := session.VentPower(ctx, componentID, args[0]); err != nil {
+			return fmt.Errorf("unable to modify parameters: %w", err)
+		}
+		return cli.printSuccess(opts)
+	})
+}
+
+func runStatus(ctx context.Context, cli *cli, c *spiroflex.Config, opts options, args []string) error {
+	installation, d, err := c.LookupDevice(opts.device)
+	if err != nil {
+		return &usageError{err: err}
+	}
+
+	return withDevice(ctx, c, opts, func(session *econet.MQTTSession, componentID string) error {
+		values, err := session.GetValues(ctx, componentID, econet.ParamVentLevel.ID, econet.ParamVentMode.ID, econet.ParamVentPower.ID)
+		if err != nil {
+			return fmt.Errorf("unable to read parameters: %w", err)
+		}
+
+		status := deviceStatus{
+			Installation: installation,
+			Device:       d.Name,
+			Level:        values.Describe(econet.ParamVentLevel),
+			Mode:         values.Describe(econet.ParamVentMode),
+			Power:        values.Describe(econet.ParamVentPower),
+		}
+		if opts.json {
+			return printJSON(cli.stdout, status)
+		}
+		return printTable(cli.stdout, []string{"INSTALLATION", "DEVICE", "LEVEL", "MODE", "POWER"}, [][]string{
+			{status.Installation, status.Device, status.Level, status.Mode, status.Power},
+		})
+	})
+}
+
+func runRaw(ctx context.Context, cli *cli, c *spiroflex.Config, opts options, args []string) error {
+	installation, input := args[0], []byte(args[1])
+	if args[1] == "-" {
+		var err error
+		input, err = io.ReadAll(cli.stdin)
+		if err != nil {
+			return fmt.Errorf("unable to read operations: %w", err)
+		}
+	}
+
+	var ops []econet.OperationRequest
+	if err := json.Unmarshal(input, &ops); err != nil {
+		return &usageError{err: fmt.Errorf("invalid operations: %w", err)}
+	}
+	if err := econet.CheckReadOnly(c.RawParams, ops); err != nil {
+		if errors.Is(err, econet.ErrReadOnly) {
+			return &usageError{err: fmt.Errorf("%w, use params set -confirm to write parameters", err)}
+		}
+		return err
+	}
+
+	m := econet.NewManager(c)
+	defer m.Close()
+
+	session, err := m.Session(ctx, installation)
+	if err != nil {
+		return err
+	}
+
+	resp, err := session.SendInstallationRequest(ctx, ops)
+	if err != nil {
+		return err
+	}
+	return printJSON(cli.stdout, resp)
+}
+
+func (cli *cli) printSuccess(opts options) error {
+	if opts.json {
+		return printJSON(cli.stdout, map[string]bool{"ok": true})
+	}
+	_, err := fmt.Fprintln(cli.stdout, "OK")
+	return err
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+)
+
+type discoveredInstallation struct {
+	econet.Installation
+
+	Components []econet.ComponentOnBus `json:"components"`
+	// Error explains why components are unavailable.
+	Error string `json:"error,omitempty"`
+}
+
+// discover returns installations of the account and components on their buses.
+func discover(ctx context.Context, c *spiroflex.Config) ([]discoveredInstallation, error) {
+	m := econet.NewManager(c)
+	defer m.Close()
+
+	installations, err := m.Installations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var discovered []discoveredInstallation
+	for _, ins := range installations {
+		d := discoveredInstallation{Installation: ins, Components: []econet.ComponentOnBus{}}
+		switch {
+		case !ins.HasAccess:
+			d.Error = "no access"
+		case !ins.IsConnected:
+			d.Error = "not connected"
+		default:
+			components, err := m.Components(ctx, ins.ID)
+			if err != nil {
+				d.Error = err.Error()
+			} else if components != nil {
+				d.Components = components
+			}
+		}
+		discovered = append(discovered, d)
+	}
+	return discovered, nil
+}
+
+func runDiscover(ctx context.Context, cli *cli, c *spiroflex.Config, opts options, args []string) error {
+	discovered, err := discover(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	if opts.json {
+		return printJSON(cli.stdout, discovered)
+	}
+	return printDiscovered(cli.stdout, discovered)
+}
+
+func printDiscovered(w io.Writer, discovered []discoveredInstallation) error {
+	for i, d := range discovered {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "Installation %q (id: %s, access: %t, connected: %t)\n", d.Name, d.ID, d.HasAccess, d.IsConnected)
+
+		if d.Error != "" {
+			fmt.Fprintf(w, "Components are unavailable: %s\n", d.Error)
+			continue
+		}
+
+		var rows [][]string
+		for _, cob := range d.Components {
+			rows = append(rows, []string{cob.ComponentName, cob.ComponentID, strconv.Itoa(cob.ClientID), strconv.Itoa(cob.DeviceStatus),
+				cob.ProgramSeries, cob.HardwareVersion, cob.DPVersion, cob.ZDVersion})
+		}
+		err := printTable(w, []string{"COMPONENT", "ID", "CLIENT ID", "STATUS", "PROGRAM SERIES", "HARDWARE", "DP", "ZD"}, rows)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
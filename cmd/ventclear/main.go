@@ -1,27 +1,295 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
-	"net/http"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
 
 	"github.com/mtojek/spiroflex-vent-clear"
-	"github.com/mtojek/spiroflex-vent-clear/api"
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+	"github.com/mtojek/spiroflex-vent-clear/logging"
 )
 
+// Exit codes of the CLI.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+	exitConfig  = 3
+)
+
+const defaultTimeout = 30 * time.Second
+
+type options struct {
+	device  string
+	json    bool
+	timeout time.Duration
+	verbose bool
+	confirm bool
+}
+
+type command struct {
+	args    string
+	summary string
+	// server commands run until interrupted, they don't accept device and output flags.
+	server bool
+	// standalone commands don't need the config.
+	standalone bool
+
+	// flags registers flags specific to the command.
+	flags    func(fs *flag.FlagSet, opts *options)
+	validate func(args []string) error
+	run      func(ctx context.Context, cli *cli, c *spiroflex.Config, opts options, args []string) error
+}
+
+var commands = map[string]command{
+	"serve": {
+		summary: "Start the web server",
+		server:  true,
+		run:     serve,
+	},
+	"hash-password": {
+		summary:    "Read a password from stdin and print its bcrypt hash for api.auth.users",
+		standalone: true,
+		validate:   exactArgs(0),
+		run:        runHashPassword,
+	},
+	"level": {
+		args:     "1|2|3",
+		summary:  "Set the ventilation level in manual mode",
+		validate: oneOf("1", "2", "3"),
+		run:      runLevel,
+	},
+	"pause": {
+		summary:  "Pause the ventilation",
+		validate: exactArgs(0),
+		run:      runPause,
+	},
+	"mode": {
+		args:     "schedule|manual",
+		summary:  "Set the operation mode",
+		validate: oneOf(econet.ParamVentMode.AllowedValues()...),
+		run:      runMode,
+	},
+	"power": {
+		args:     "on|off",
+		summary:  "Turn the device on or off",
+		validate: oneOf(econet.ParamVentPower.AllowedValues()...),
+		run:      runPower,
+	},
+	"status": {
+		summary:  "Print the level, mode and power of the device",
+		validate: exactArgs(0),
+		run:      runStatus,
+	},
+	"discover": {
+		summary:  "Print installations and components on their buses",
+		validate: exactArgs(0),
+		run:      runDiscover,
+	},
+	"params": {
+		args:    "get ID... | set ID=VALUE...",
+		summary: "Read or write arbitrary parameters permitted by raw_params in the config",
+		flags: func(fs *flag.FlagSet, opts *options) {
+			fs.BoolVar(&opts.confirm, "confirm", false, "confirm writing parameters")
+		},
+		validate: validateParams,
+		run:      runParams,
+	},
+	"raw": {
+		args:     "INSTALLATION OPERATIONS|-",
+		summary:  "Send read-only operations (a JSON array, - reads stdin) to the installation and print the response",
+		validate: exactArgs(2),
+		run:      runRaw,
+	},
+}
+
+// usageError is returned for invalid command-line arguments.
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+type cli struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+
+	loadConfig func() (*spiroflex.Config, error)
+}
+
 func main() {
-	c, err := spiroflex.LoadConfig()
+	app := &cli{
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+
+		loadConfig: spiroflex.LoadConfig,
+	}
+	os.Exit(app.run(os.Args[1:]))
+}
+
+func (cli *cli) run(args []string) int {
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		cli.usage()
+		return exitOK
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(cli.stderr, "Unknown command: %s\n\n", name)
+		cli.usage()
+		return exitUsage
+	}
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(cli.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(cli.stderr, "Usage: ventclear %s [flags] %s\n\n%s.\n\nFlags:\n", name, cmd.args, cmd.summary)
+		fs.PrintDefaults()
+	}
+
+	var opts options
+	if !cmd.server {
+		fs.StringVar(&opts.device, "device", "", "friendly name of the device, the default one if empty")
+		fs.BoolVar(&opts.json, "json", false, "print output as JSON")
+		fs.DurationVar(&opts.timeout, "timeout", defaultTimeout, "timeout of the command")
+		fs.BoolVar(&opts.verbose, "v", false, "log messages exchanged with the installation")
+	}
+	if cmd.flags != nil {
+		cmd.flags(fs, &opts)
+	}
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	if cmd.validate != nil {
+		if err := cmd.validate(positional); err != nil {
+			fmt.Fprintf(cli.stderr, "Error: %v\n\n", err)
+			fs.Usage()
+			return exitUsage
+		}
+	}
+
+	var c *spiroflex.Config
+	if !cmd.standalone {
+		var err error
+		c, err = cli.loadConfig()
+		if err != nil {
+			fmt.Fprintf(cli.stderr, "Error: can't load config: %v\n", err)
+			return exitConfig
+		}
+	}
+
+	logger, err := cli.logger(cmd, c, opts)
 	if err != nil {
-		log.Fatalf("can't load config: %v", err)
+		fmt.Fprintf(cli.stderr, "Error: can't load config: %v\n", err)
+		return exitConfig
 	}
+	defer restoreLogger(slog.Default(), log.Writer(), log.Flags())
+	slog.SetDefault(logger)
 
-	webServer := api.NewWebServer(c)
-	srv := &http.Server{
-		Addr:    c.API.Endpoint,
-		Handler: webServer.Handler(),
+	ctx := context.Background()
+	if !cmd.server {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+
+	err = cmd.run(ctx, cli, c, opts, positional)
+	if err != nil {
+		fmt.Fprintf(cli.stderr, "Error: %v\n", err)
+
+		var ue *usageError
+		if errors.As(err, &ue) {
+			return exitUsage
+		}
+		return exitFailure
+	}
+	return exitOK
+}
+
+// logger returns the logger of the command. Commands other than the server stay quiet,
+// unless run with -v, which enables debug logs.
+func (cli *cli) logger(cmd command, c *spiroflex.Config, opts options) (*slog.Logger, error) {
+	if cmd.server {
+		return logging.New(cli.stderr, c)
+	}
+	if !opts.verbose {
+		return slog.New(slog.NewTextHandler(io.Discard, nil)), nil
 	}
 
-	log.Printf("Server started at %v", c.API.Endpoint)
-	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
-		log.Fatalf("srv.ListenAndServe failed: %v", err)
+	var verbose spiroflex.Config
+	if c != nil {
+		verbose = *c
+	}
+	verbose.Log.Level = "debug"
+	return logging.New(cli.stderr, &verbose)
+}
+
+// restoreLogger reverts slog.SetDefault, which redirects the standard logger too.
+func restoreLogger(logger *slog.Logger, w io.Writer, flags int) {
+	slog.SetDefault(logger)
+	log.SetOutput(w)
+	log.SetFlags(flags)
+}
+
+// parseInterspersed parses flags placed anywhere among arguments, e.g. params set -confirm u81=4.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+
+		consumed := len(args) - fs.NArg()
+		if fs.NArg() == 0 || (consumed > 0 && args[consumed-1] == "--") {
+			return append(positional, fs.Args()...), nil
+		}
+
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func (cli *cli) usage() {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(cli.stderr, "Usage: ventclear <command> [flags] [arguments]\n\nCommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(cli.stderr, "  %-14s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(cli.stderr, "\nThe web server is started if no command is given. Run \"ventclear <command> -h\" for flags of the command.\n")
+}
+
+func exactArgs(n int) func(args []string) error {
+	return func(args []string) error {
+		if len(args) != n {
+			return fmt.Errorf("expected %d argument(s), got %d", n, len(args))
+		}
+		return nil
 	}
 }
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+	"github.com/mtojek/spiroflex-vent-clear/api"
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+	"github.com/mtojek/spiroflex-vent-clear/fakeaws"
+	"github.com/mtojek/spiroflex-vent-clear/simulator"
+)
+
+type offlineStack struct {
+	c      *spiroflex.Config
+	srv    *httptest.Server
+	aws    *fakeaws.Server
+	device *simulator.Device
+}
+
+func startOffline(t *testing.T) *offlineStack {
+	t.Helper()
+
+	c := &spiroflex.Config{
+		Region: "eu-west-3",
+		Cognito: spiroflex.CognitoConfig{
+			Username:       "user@example.com",
+			Password:       "fake-password",
+			UserPoolID:     "eu-west-3_examplePool",
+			ClientID:       "abc123exampleclientid",
+			IdentityPoolID: "eu-west-3:12345678-abcd-ef01-2345-6789abcdef01",
+		},
+		Installations: []spiroflex.Installation{
+			{
+				Name: "SCP V",
+				Devices: []spiroflex.Device{
+					{Name: "Living room"},
+					{Name: "Attic", Component: "ecoVENT MAXI"},
+				},
+			},
+		},
+		API:     spiroflex.API{Rest: true, SmartHome: true, Metrics: true, Debug: true},
+		Storage: spiroflex.Storage{Dir: t.TempDir()},
+	}
+
+	aws := fakeaws.NewServer(fakeaws.Options{
+		Region:         c.Region,
+		UserPoolID:     c.Cognito.UserPoolID,
+		ClientID:       c.Cognito.ClientID,
+		IdentityPoolID: c.Cognito.IdentityPoolID,
+		Username:       c.Cognito.Username,
+		Password:       c.Cognito.Password,
+		Installations: []econet.Installation{
+			{ID: "installation-1", Name: "SCP V", HasAccess: true, IsConnected: true},
+		},
+	})
+	t.Cleanup(aws.Close)
+
+	wsAddr := freeAddr(t)
+	broker, err := simulator.NewBroker("", wsAddr)
+	if err != nil {
+		t.Fatalf("NewBroker failed: %v", err)
+	}
+	t.Cleanup(func() { broker.Close() })
+
+	device := simulator.NewDevice(simulator.Options{})
+	if err := simulator.New(device, broker).Start(); err != nil {
+		t.Fatalf("simulator start failed: %v", err)
+	}
+
+	c.Endpoints = spiroflex.Endpoints{
+		CognitoIDP:      aws.URL,
+		CognitoIdentity: aws.URL,
+		Gateway:         aws.URL,
+		IoT:             fmt.Sprintf("ws://%s/mqtt", wsAddr),
+	}
+
+	webServer := api.NewWebServer(c)
+	t.Cleanup(webServer.Close)
+	srv := httptest.NewServer(webServer.Handler())
+	t.Cleanup(srv.Close)
+
+	return &offlineStack{c: c, srv: srv, aws: aws, device: device}
+}
+
+func TestOffline(t *testing.T) {
+	stack := startOffline(t)
+	srv, aws := stack.srv, stack.aws
+
+	for _, path := range []string{"/api/vent/power/on", "/api/vent/level/3", "/api/vent/mode/manual"} {
+		resp, err := http.Post(srv.URL+path, "application/json", nil)
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("POST %s: unexpected status %s", path, resp.Status)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "/api/vent/status")
+	if err != nil {
+		t.Fatalf("GET status failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var status map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("can't decode status: %v", err)
+	}
+
+	expected := map[string]string{"level": "3", "mode": "manual", "power": "on"}
+	for k, v := range expected {
+		if status[k] != v {
+			t.Errorf("status %s: expected %s, got %s", k, v, status[k])
+		}
+	}
+
+	if logins := aws.SRPLogins(); logins != 1 {
+		t.Errorf("expected a single SRP login, got %d", logins)
+	}
+}
+
+func TestOfflineSmartHome(t *testing.T) {
+	stack := startOffline(t)
+
+	directive := func(namespace, name, payload string) map[string]any {
+		body := fmt.Sprintf(`{"directive":{"header":{"namespace":%q,"name":%q,"payloadVersion":"3","messageId":"1","correlationToken":"token"},"endpoint":{"endpointId":"spiroflex-vent"},"payload":%s}}`, namespace, name, payload)
+		resp, err := http.Post(stack.srv.URL+"/alexa/smarthome", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST directive failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var e map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+			t.Fatalf("can't decode event: %v", err)
+		}
+		return e
+	}
+	eventName := func(e map[string]any) string {
+		return e["event"].(map[string]any)["header"].(map[string]any)["name"].(string)
+	}
+
+	if e := directive("Alexa.Discovery", "Discover", `{}`); eventName(e) != "Discover.Response" {
+		t.Errorf("unexpected discovery response: %v", e)
+	}
+	if e := directive("Alexa.RangeController", "SetRangeValue", `{"rangeValue":2}`); eventName(e) != "Response" {
+		t.Errorf("unexpected SetRangeValue response: %v", e)
+	}
+	if e := directive("Alexa.RangeController", "AdjustRangeValue", `{"rangeValueDelta":-5}`); eventName(e) != "Response" {
+		t.Errorf("unexpected AdjustRangeValue response: %v", e)
+	}
+	if level := stack.device.Values()[econet.ParamVentLevel.ID]; level != "6" {
+		t.Errorf("expected paused vent, got level %s", level)
+	}
+	if e := directive("Alexa.ModeController", "SetMode", `{"mode":"Mode.Unknown"}`); eventName(e) != "ErrorResponse" {
+		t.Errorf("expected error response, got %v", e)
+	}
+
+	e := directive("Alexa", "ReportState", `{}`)
+	if eventName(e) != "StateReport" {
+		t.Fatalf("unexpected ReportState response: %v", e)
+	}
+	if properties := e["context"].(map[string]any)["properties"].([]any); len(properties) != 3 {
+		t.Errorf("expected 3 properties, got %v", properties)
+	}
+}
+
+func TestOfflineDevices(t *testing.T) {
+	stack := startOffline(t)
+
+	tests := []struct {
+		path           string
+		expectedStatus int
+		expectedCode   string
+		expectedError  string
+	}{
+		{path: "/api/installations/SCP%20V/devices/living%20room/level/2", expectedStatus: http.StatusOK},
+		{path: "/api/installations/SCP%20V/devices/ecoVENT%20MINI%20OEM/pause", expectedStatus: http.StatusOK},
+		{path: "/api/installations/SCP%20V/devices/Attic/pause", expectedStatus: http.StatusNotFound, expectedCode: "not_found", expectedError: `component not found: "ecoVENT MAXI"`},
+		{path: "/api/installations/SCP%20V/devices/Kitchen/pause", expectedStatus: http.StatusNotFound, expectedCode: "not_found", expectedError: "device Kitchen is not configured"},
+		{path: "/api/installations/Other/devices/Attic/pause", expectedStatus: http.StatusNotFound, expectedCode: "not_found", expectedError: "installation Other is not configured"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := http.Post(stack.srv.URL+tt.path, "application/json", nil)
+			if err != nil {
+				t.Fatalf("POST failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %s", tt.expectedStatus, resp.Status)
+			}
+
+			var body struct {
+				Error string `json:"error"`
+				Code  string `json:"code"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("can't decode response: %v", err)
+			}
+			if !strings.Contains(body.Error, tt.expectedError) {
+				t.Errorf("expected error containing %q, got %q", tt.expectedError, body.Error)
+			}
+			if body.Code != tt.expectedCode {
+				t.Errorf("expected code %q, got %q", tt.expectedCode, body.Code)
+			}
+		})
+	}
+
+	if level := stack.device.Values()[econet.ParamVentLevel.ID]; level != "6" {
+		t.Errorf("expected paused vent, got level %s", level)
+	}
+}
+
+func TestOfflineDiscovery(t *testing.T) {
+	stack := startOffline(t)
+
+	getJSON := func(path string, v any) {
+		resp, err := http.Get(stack.srv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: unexpected status %s", path, resp.Status)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("can't decode response: %v", err)
+		}
+	}
+
+	var installations []econet.Installation
+	getJSON("/api/installations", &installations)
+	if len(installations) != 1 || installations[0].ID != "installation-1" {
+		t.Fatalf("unexpected installations: %+v", installations)
+	}
+
+	// Devices can be addressed by the ID of their installation.
+	resp, err := http.Post(stack.srv.URL+"/api/installations/"+installations[0].ID+"/devices/living%20room/level/3", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected device addressed by installation ID, got %s", resp.Status)
+	}
+
+	var components []econet.ComponentOnBus
+	getJSON("/api/installations/installation-1/components", &components)
+	if !slices.ContainsFunc(components, func(c econet.ComponentOnBus) bool { return c.ComponentName == "ecoVENT MINI OEM" }) {
+		t.Errorf("expected ecoVENT MINI OEM on the bus, got %+v", components)
+	}
+
+	code, out, _ := runCLI(t, stack, "discover")
+	if code != exitOK {
+		t.Fatalf("expected exit code %d, got %d", exitOK, code)
+	}
+	for _, expected := range []string{`Installation "SCP V" (id: installation-1`, "ecoVENT MINI OEM"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected output to contain %q, got:\n%s", expected, out)
+		}
+	}
+}
+
+func TestOfflineParams(t *testing.T) {
+	stack := startOffline(t)
+	stack.c.RawParams = spiroflex.RawParams{Allow: []string{"u81"}}
+
+	post := func(body string) (int, string) {
+		resp, err := http.Post(stack.srv.URL+"/api/vent/params", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST params failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var r struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&r)
+		return resp.StatusCode, r.Error
+	}
+
+	if status, msg := post(`{"values":{"u81":"4"}}`); status == http.StatusOK || !strings.Contains(msg, "must be confirmed") {
+		t.Errorf("expected unconfirmed write to fail, got %d %q", status, msg)
+	}
+	if status, msg := post(`{"values":{"u7074":"H0L1"},"confirm":true}`); status == http.StatusOK || !strings.Contains(msg, "not allowed") {
+		t.Errorf("expected write of a parameter not allowed to fail, got %d %q", status, msg)
+	}
+	if status, msg := post(`{"values":{"u81":"4"},"confirm":true}`); status != http.StatusOK {
+		t.Fatalf("expected write to succeed, got %d %q", status, msg)
+	}
+
+	resp, err := http.Get(stack.srv.URL + "/api/vent/params?ids=u81")
+	if err != nil {
+		t.Fatalf("GET params failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var values map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&values); err != nil {
+		t.Fatalf("can't decode params: %v", err)
+	}
+	if values["u81"] != "4" {
+		t.Errorf("expected u81 to be 4, got %v", values)
+	}
+}
+
+func TestOfflineMetrics(t *testing.T) {
+	stack := startOffline(t)
+
+	for _, path := range []string{"/api/vent/power/on", "/api/vent/level/2"} {
+		resp, err := http.Post(stack.srv.URL+path, "application/json", nil)
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(stack.srv.URL + "/api/vent/status")
+	if err != nil {
+		t.Fatalf("GET status failed: %v", err)
+	}
+	resp.Body.Close()
+
+	resp, err = http.Get(stack.srv.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET metrics failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("can't read metrics: %v", err)
+	}
+
+	expected := []*regexp.Regexp{
+		regexp.MustCompile(`(?m)^ventclear_http_requests_total\{code="200",method="POST",route="/api/vent/level/\{level:\[1-3\]\?\}"\} \d+$`),
+		regexp.MustCompile(`(?m)^ventclear_http_request_duration_seconds_count\{method="GET",route="/api/vent/status"\} \d+$`),
+		regexp.MustCompile(`(?m)^ventclear_cognito_auth_attempts_total\{flow="srp"\} \d+$`),
+		regexp.MustCompile(`(?m)^ventclear_mqtt_connects_total \d+$`),
+		regexp.MustCompile(`(?m)^ventclear_mqtt_request_duration_seconds_count\{operation="GET_VALUES",result="ok"\} \d+$`),
+		regexp.MustCompile(`(?m)^ventclear_mqtt_pending_transactions\{installation="installation-1"\} 0$`),
+		regexp.MustCompile(`(?m)^ventclear_device_level\{component="[^"]+",installation="installation-1"\} 2$`),
+		regexp.MustCompile(`(?m)^ventclear_device_schedule_mode\{component="[^"]+",installation="installation-1"\} 0$`),
+		regexp.MustCompile(`(?m)^ventclear_device_power\{component="[^"]+",installation="installation-1"\} 1$`),
+	}
+	for _, re := range expected {
+		if !re.Match(body) {
+			t.Errorf("metrics don't match %s", re)
+		}
+	}
+}
+
+func TestOfflineHealth(t *testing.T) {
+	stack := startOffline(t)
+
+	resp, err := http.Get(stack.srv.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("GET healthz failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected healthz status 200, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(stack.srv.URL + "/readyz")
+	if err != nil {
+		t.Fatalf("GET readyz failed: %v", err)
+	}
+	var readiness struct {
+		Ready  bool
+		Checks []struct {
+			Name string
+			Ok   bool
+		}
+	}
+	err = json.NewDecoder(resp.Body).Decode(&readiness)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("can't decode readiness: %v", err)
+	}
+	// The Attic device isn't on the bus of the simulator.
+	if resp.StatusCode != http.StatusServiceUnavailable || readiness.Ready {
+		t.Errorf("expected not ready, got status %d: %+v", resp.StatusCode, readiness)
+	}
+	var failed []string
+	for _, c := range readiness.Checks {
+		if !c.Ok {
+			failed = append(failed, c.Name)
+		}
+	}
+	if len(readiness.Checks) != 3 || !slices.Equal(failed, []string{"device Attic"}) {
+		t.Errorf("expected failed Attic check, got %+v", readiness.Checks)
+	}
+
+	resp, err = http.Get(stack.srv.URL + "/debug/econet")
+	if err != nil {
+		t.Fatalf("GET debug failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var diag econet.Diagnostics
+	if err := json.NewDecoder(resp.Body).Decode(&diag); err != nil {
+		t.Fatalf("can't decode diagnostics: %v", err)
+	}
+	if !diag.Authenticated || diag.CredentialsExpireAt == nil {
+		t.Errorf("expected valid credentials, got %+v", diag)
+	}
+	if len(diag.Sessions) != 1 {
+		t.Fatalf("expected a single session, got %d", len(diag.Sessions))
+	}
+
+	session := diag.Sessions[0]
+	if !session.Connected || session.ClientID == "" || session.PendingTransactions != 0 {
+		t.Errorf("unexpected session state: %+v", session)
+	}
+	if !slices.Contains(session.Topics, "installation-1/"+session.ClientID+"/installationResponse") {
+		t.Errorf("response topic isn't subscribed: %v", session.Topics)
+	}
+
+	var directions []string
+	for _, e := range session.Envelopes {
+		directions = append(directions, e.Direction)
+	}
+	// Components on the bus are fetched for both devices.
+	expected := []string{econet.DirectionRequest, econet.DirectionResponse, econet.DirectionRequest, econet.DirectionResponse}
+	if !slices.Equal(directions, expected) {
+		t.Errorf("expected %v, got %v", expected, directions)
+	}
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen failed: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestOfflineReadinessBackoff(t *testing.T) {
+	stack := startOffline(t)
+	stack.c.Cognito.Password = "wrong-password"
+
+	for i := 0; i < 3; i++ {
+		resp, err := http.Get(stack.srv.URL + "/readyz")
+		if err != nil {
+			t.Fatalf("GET readyz failed: %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("can't read readiness: %v", err)
+		}
+
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("expected status 503, got %d", resp.StatusCode)
+		}
+		// Errors aren't exposed by the unauthenticated endpoint.
+		if expected := `{"ready":false,"checks":[{"name":"cognito","ok":false}]}`; strings.TrimSpace(string(body)) != expected {
+			t.Errorf("expected %s, got %s", expected, body)
+		}
+	}
+
+	if n := stack.aws.SRPAttempts(); n != 1 {
+		t.Errorf("expected a single login attempt, got %d", n)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+)
+
+func validateParams(args []string) error {
+	if len(args) < 2 || (args[0] != "get" && args[0] != "set") {
+		return errors.New("expected get or set followed by parameters")
+	}
+
+	if args[0] == "set" {
+		_, err := parseAssignments(args[1:])
+		return err
+	}
+	return nil
+}
+
+func parseAssignments(args []string) (econet.Values, error) {
+	values := econet.Values{}
+	for _, arg := range args {
+		id, value, ok := strings.Cut(arg, "=")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid assignment %q, expected ID=VALUE", arg)
+		}
+		values[id] = value
+	}
+	return values, nil
+}
+
+func runParams(ctx context.Context, cli *cli, c *spiroflex.Config, opts options, args []string) error {
+	if args[0] == "set" && !opts.confirm {
+		return &usageError{err: econet.ErrUnconfirmedWrite}
+	}
+
+	return withDevice(ctx, c, opts, func(session *econet.MQTTSession, componentID string) error {
+		if args[0] == "set" {
+			values, _ := parseAssignments(args[1:])
+			if err := session.SetRawValues(ctx, componentID, c.RawParams, values, opts.confirm); err != nil {
+				return fmt.Errorf("unable to modify parameters: %w", err)
+			}
+			return cli.printSuccess(opts)
+		}
+
+		values, err := session.GetRawValues(ctx, componentID, c.RawParams, args[1:]...)
+		if err != nil {
+			return fmt.Errorf("unable to read parameters: %w", err)
+		}
+		if opts.json {
+			return printJSON(cli.stdout, values)
+		}
+
+		var rows [][]string
+		for id, raw := range values {
+			name, decoded := "", ""
+			if p, ok := econet.LookupParam(id); ok {
+				name, decoded = p.Name, values.Describe(p)
+			}
+			rows = append(rows, []string{id, raw, name, decoded})
+		}
+		sort.Slice(rows, func(i, j int) bool { return rows[i][0] < rows[j][0] })
+		return printTable(cli.stdout, []string{"ID", "VALUE", "NAME", "DECODED"}, rows)
+	})
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func runHashPassword(ctx context.Context, cli *cli, c *spiroflex.Config, opts options, args []string) error {
+	line, err := bufio.NewReader(cli.stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return errors.New("unable to read password from stdin")
+	}
+
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return &usageError{err: errors.New("empty password")}
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("unable to hash password: %w", err)
+	}
+	_, err = fmt.Fprintln(cli.stdout, string(hash))
+	return err
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+	"github.com/mtojek/spiroflex-vent-clear/api"
+	"github.com/mtojek/spiroflex-vent-clear/systemd"
+	"github.com/mtojek/spiroflex-vent-clear/tlsutil"
+	"github.com/mtojek/spiroflex-vent-clear/tracing"
+)
+
+// shutdownTimeout limits draining HTTP requests and MQTT transactions on shutdown.
+const shutdownTimeout = 30 * time.Second
+
+func serve(ctx context.Context, cli *cli, c *spiroflex.Config, opts options, args []string) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, cli.stdout, c)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Warn("Spans weren't exported", "error", err)
+		}
+	}()
+
+	srv := &http.Server{}
+	if c.API.TLS.Enabled() {
+		reloader, err := tlsutil.NewReloader(c.API.TLS.Cert, c.API.TLS.Key)
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig, err = tlsutil.ServerConfig(c.API.TLS, reloader)
+		if err != nil {
+			return err
+		}
+		go reloader.Run(ctx)
+	}
+
+	l, err := net.Listen("tcp", c.API.Endpoint)
+	if err != nil {
+		return fmt.Errorf("unable to listen at %s: %w", c.API.Endpoint, err)
+	}
+
+	var redirect *http.Server
+	var redirectListener net.Listener
+	if c.API.TLS.Enabled() && c.API.TLS.RedirectFrom != "" {
+		redirectListener, err = net.Listen("tcp", c.API.TLS.RedirectFrom)
+		if err != nil {
+			l.Close()
+			return fmt.Errorf("unable to listen at %s: %w", c.API.TLS.RedirectFrom, err)
+		}
+		redirect = &http.Server{Handler: tlsutil.RedirectHandler(c.API.Endpoint)}
+	}
+
+	webServer := api.NewWebServer(c)
+	srv.Handler = webServer.Handler()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			slog.Info("Server started", "endpoint", c.API.Endpoint, "tls", true)
+			serveErr <- srv.ServeTLS(l, "", "")
+			return
+		}
+		slog.Info("Server started", "endpoint", c.API.Endpoint, "tls", false)
+		serveErr <- srv.Serve(l)
+	}()
+
+	if redirect != nil {
+		go func() {
+			slog.Info("Redirecting HTTP requests to HTTPS", "endpoint", c.API.TLS.RedirectFrom)
+			if err := redirect.Serve(redirectListener); err != http.ErrServerClosed {
+				slog.Error("HTTP redirect listener failed", "error", err)
+			}
+		}()
+	}
+
+	notify(systemd.Ready)
+	interval, err := systemd.WatchdogInterval()
+	if err != nil {
+		slog.Warn("Watchdog is disabled", "error", err)
+	} else if interval > 0 {
+		go systemd.Watchdog(ctx, interval, func() error {
+			return checkListener(l.Addr(), srv.TLSConfig != nil)
+		})
+	}
+
+	var failure error
+	select {
+	case <-ctx.Done():
+		slog.Info("Shutting down, waiting for pending requests", "timeout", shutdownTimeout)
+	case err := <-serveErr:
+		failure = fmt.Errorf("server failed: %w", err)
+	}
+	// Restore the default signal handling, so another signal terminates the process immediately.
+	stop()
+	notify(systemd.Stopping)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if redirect != nil {
+		redirect.Shutdown(shutdownCtx)
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("HTTP requests weren't drained", "error", err)
+	}
+	if err := webServer.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Shutdown incomplete", "error", err)
+	}
+	slog.Info("Server stopped")
+	return failure
+}
+
+func notify(state string) {
+	if err := systemd.Notify(state); err != nil {
+		slog.Warn("Can't notify systemd", "state", state, "error", err)
+	}
+}
+
+// checkListener verifies the server still accepts connections. With TLS, it completes the
+// handshake, so the server doesn't log the check as a failed one.
+func checkListener(addr net.Addr, useTLS bool) error {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !useTLS {
+		conn, err := dialer.Dial(addr.Network(), addr.String())
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	// The certificate is issued for the public name of the server, not the address of the listener.
+	conn, err := tls.DialWithDialer(dialer, addr.Network(), addr.String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
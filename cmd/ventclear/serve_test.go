@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+	"github.com/mtojek/spiroflex-vent-clear/systemd"
+)
+
+func TestServeShutdown(t *testing.T) {
+	stack := startOffline(t)
+
+	c := *stack.c
+	c.API.Endpoint = freeAddr(t)
+
+	notifySocket := filepath.Join(t.TempDir(), "notify.sock")
+	notifications, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: notifySocket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("ListenUnixgram failed: %v", err)
+	}
+	defer notifications.Close()
+	t.Setenv("NOTIFY_SOCKET", notifySocket)
+
+	expectNotification := func(expected string) {
+		t.Helper()
+
+		notifications.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, 64)
+		n, err := notifications.Read(buf)
+		if err != nil {
+			t.Fatalf("expected notification %s: %v", expected, err)
+		}
+		if state := string(buf[:n]); state != expected {
+			t.Fatalf("expected notification %s, got %s", expected, state)
+		}
+	}
+
+	var stderr bytes.Buffer
+	app := &cli{
+		stdin:  strings.NewReader(""),
+		stdout: &bytes.Buffer{},
+		stderr: &stderr,
+
+		loadConfig: func() (*spiroflex.Config, error) {
+			return &c, nil
+		},
+	}
+
+	exitCode := make(chan int, 1)
+	go func() {
+		exitCode <- app.run([]string{"serve"})
+	}()
+	expectNotification(systemd.Ready)
+
+	// Open an MQTT session to be drained on shutdown.
+	resp, err := http.Post("http://"+c.API.Endpoint+"/api/vent/power/on", "", nil)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("Kill failed: %v", err)
+	}
+	expectNotification(systemd.Stopping)
+
+	select {
+	case code := <-exitCode:
+		if code != exitOK {
+			t.Errorf("expected exit code %d, got %d: %s", exitOK, code, stderr.String())
+		}
+	case <-time.After(shutdownTimeout):
+		t.Fatal("server didn't stop")
+	}
+
+	if _, err := net.DialTimeout("tcp", c.API.Endpoint, time.Second); err == nil {
+		t.Error("server still accepts connections after shutdown")
+	}
+}
+
+func TestCheckListener(t *testing.T) {
+	for _, useTLS := range []bool{false, true} {
+		t.Run(fmt.Sprintf("tls %t", useTLS), func(t *testing.T) {
+			var errorLog bytes.Buffer
+			closed := make(chan struct{}, 1)
+			srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+			srv.Config.ErrorLog = log.New(&errorLog, "", 0)
+			srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateClosed {
+					closed <- struct{}{}
+				}
+			}
+			if useTLS {
+				srv.StartTLS()
+			} else {
+				srv.Start()
+			}
+			defer srv.Close()
+
+			if err := checkListener(srv.Listener.Addr(), useTLS); err != nil {
+				t.Fatalf("checkListener failed: %v", err)
+			}
+
+			select {
+			case <-closed:
+			case <-time.After(5 * time.Second):
+				t.Fatal("connection of the check isn't closed")
+			}
+			// The server logs errors of a connection before it's closed.
+			if errorLog.Len() > 0 {
+				t.Errorf("expected no server errors, got %s", errorLog.String())
+			}
+		})
+	}
+}
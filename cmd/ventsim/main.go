@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+	"github.com/mtojek/spiroflex-vent-clear/logging"
+	"github.com/mtojek/spiroflex-vent-clear/simulator"
+)
+
+func main() {
+	var opts simulator.Options
+	flag.StringVar(&opts.ComponentID, "component-id", "1", "component ID of the simulated ecoVENT MINI OEM")
+	flag.DurationVar(&opts.Latency, "latency", 0, "delay of every response")
+	flag.DurationVar(&opts.Jitter, "jitter", 0, "random delay added to the latency")
+	flag.Float64Var(&opts.ErrorRate, "error-rate", 0, "probability of failing an operation target (0-1)")
+	flag.IntVar(&opts.ErrorStatusCode, "error-status", simulator.StatusInvalidValue, "status code of failed operation targets")
+	flag.Float64Var(&opts.DropRate, "drop-rate", 0, "probability of not answering a request (0-1)")
+
+	brokerURL := flag.String("broker", "", "URL of an external MQTT broker, e.g. tcp://localhost:1883 (embedded broker is started if empty)")
+	listen := flag.String("listen", "127.0.0.1:1883", "TCP address of the embedded broker")
+	listenWS := flag.String("listen-ws", "127.0.0.1:1882", "websocket address of the embedded broker")
+	var logConfig spiroflex.Log
+	flag.StringVar(&logConfig.Level, "log-level", "info", "log level: debug, info, warn or error (debug logs all messages)")
+	flag.StringVar(&logConfig.Format, "log-format", spiroflex.LogFormatText, "log format: text or json")
+	flag.Parse()
+
+	logger, err := logging.New(os.Stderr, &spiroflex.Config{Log: logConfig})
+	if err != nil {
+		fatal("invalid logging flags", err)
+	}
+	slog.SetDefault(logger)
+
+	var ps interface {
+		simulator.PubSub
+		io.Closer
+	}
+	if *brokerURL != "" {
+		client, err := simulator.Dial(*brokerURL, fmt.Sprintf("ventsim-%d", os.Getpid()))
+		if err != nil {
+			fatal("can't connect to MQTT broker", err)
+		}
+		slog.Info("Connected to MQTT broker", "url", *brokerURL)
+		ps = client
+	} else {
+		broker, err := simulator.NewBroker(*listen, *listenWS)
+		if err != nil {
+			fatal("can't start MQTT broker", err)
+		}
+		slog.Info("Embedded MQTT broker started", "tcp", *listen, "ws", *listenWS)
+		ps = broker
+	}
+	defer ps.Close()
+
+	sim := simulator.New(simulator.NewDevice(opts), ps)
+	if err := sim.Start(); err != nil {
+		fatal("can't start simulator", err)
+	}
+	slog.Info("Simulating device", "name", simulator.VentComponentName, "component_id", opts.ComponentID)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
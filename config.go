@@ -2,7 +2,12 @@ package spiroflex
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -16,10 +21,21 @@ type Config struct {
 	Gateway APIGateway
 	IoT     AWSIoT
 
-	Installation Installation
+	Endpoints Endpoints
+
+	// Installation is the single installation of older configs, it's merged into Installations.
+	Installation  Installation
+	Installations []Installation
+
+	DeviceSchedule DeviceSchedule `mapstructure:"device_schedule"`
+	RawParams      RawParams      `mapstructure:"raw_params"`
 
 	API   API
 	Alexa Alexa
+
+	Storage Storage
+	Log     Log
+	Tracing Tracing
 }
 
 type CognitoConfig struct {
@@ -38,15 +54,338 @@ type AWSIoT struct {
 	Name string
 }
 
+// Endpoints override AWS service URLs, e.g. to run against a local stand-in.
+type Endpoints struct {
+	CognitoIDP      string `mapstructure:"cognito_idp"`
+	CognitoIdentity string `mapstructure:"cognito_identity"`
+	Gateway         string
+	IoT             string
+}
+
+// DefaultComponent is the name of the ventilation unit on the installation bus.
+const DefaultComponent = "ecoVENT MINI OEM"
+
+// DefaultDeviceName is the friendly name of a device with no configured name.
+const DefaultDeviceName = "Vent"
+
 type Installation struct {
+	Name    string
+	Devices []Device
+}
+
+// Device is a ventilation unit on the bus of an installation.
+type Device struct {
+	// Name is the friendly name, e.g. used by Alexa. It must be unique across installations.
 	Name string
+	// Component is the name of the component on the bus.
+	Component string
+	// ComponentID identifies the component if several on the bus have the same name.
+	ComponentID string `mapstructure:"component_id"`
+}
+
+// AllInstallations returns the configured installations with defaults applied,
+// the first device of the first installation is the default device.
+func (c *Config) AllInstallations() []Installation {
+	var configured []Installation
+	if c.Installation.Name != "" {
+		configured = append(configured, c.Installation)
+	}
+	for _, ins := range c.Installations {
+		if ins.Name == c.Installation.Name && len(configured) > 0 {
+			configured[0].Devices = slices.Concat(configured[0].Devices, ins.Devices)
+			continue
+		}
+		configured = append(configured, ins)
+	}
+
+	var installations []Installation
+	for _, ins := range configured {
+		devices := ins.Devices
+		if len(devices) == 0 {
+			devices = []Device{{}}
+		}
+
+		withDefaults := Installation{Name: ins.Name}
+		for _, d := range devices {
+			if d.Component == "" {
+				d.Component = DefaultComponent
+			}
+			if d.Name == "" {
+				d.Name = DefaultDeviceName
+			}
+			withDefaults.Devices = append(withDefaults.Devices, d)
+		}
+		installations = append(installations, withDefaults)
+	}
+	return installations
+}
+
+// LookupDevice returns the name of the installation and the device with the friendly name,
+// or the default device if the name is empty.
+func (c *Config) LookupDevice(name string) (string, Device, error) {
+	installations := c.AllInstallations()
+	if len(installations) == 0 {
+		return "", Device{}, fmt.Errorf("no devices are %w", ErrNotConfigured)
+	}
+	if name == "" {
+		return installations[0].Name, installations[0].Devices[0], nil
+	}
+
+	for _, ins := range installations {
+		for _, d := range ins.Devices {
+			if strings.EqualFold(d.Name, name) {
+				return ins.Name, d, nil
+			}
+		}
+	}
+	return "", Device{}, fmt.Errorf("device %s is %w", name, ErrNotConfigured)
+}
+
+func (c *Config) validate() error {
+	if err := c.Log.validate(); err != nil {
+		return fmt.Errorf("log: %w", err)
+	}
+	if err := c.Tracing.validate(); err != nil {
+		return fmt.Errorf("tracing: %w", err)
+	}
+	if err := c.API.Auth.validate(); err != nil {
+		return fmt.Errorf("api.auth: %w", err)
+	}
+	if c.API.TLS.Enabled() && (c.API.TLS.Cert == "" || c.API.TLS.Key == "") {
+		return fmt.Errorf("api.tls: both cert and key are required")
+	}
+	if (c.API.TLS.ClientCA != "" || c.API.TLS.RedirectFrom != "") && !c.API.TLS.Enabled() {
+		return fmt.Errorf("api.tls: client_ca and redirect_from require cert and key")
+	}
+	if len(c.API.Auth.ClientCerts) > 0 && c.API.TLS.ClientCA == "" {
+		return fmt.Errorf("api.auth.client_certs require api.tls.client_ca")
+	}
+
+	names := map[string]string{}
+	for _, ins := range c.AllInstallations() {
+		if ins.Name == "" {
+			return fmt.Errorf("installation name is empty")
+		}
+
+		for _, d := range ins.Devices {
+			key := strings.ToLower(d.Name)
+			if other, ok := names[key]; ok {
+				return fmt.Errorf("device name %q is used in installations %s and %s, names must be unique", d.Name, other, ins.Name)
+			}
+			names[key] = ins.Name
+		}
+	}
+	return nil
+}
+
+// DeviceSchedule maps days of the week (mon-sun) to IDs of parameters holding the
+// native weekly schedule of the device. Experimental, the encoding is unverified.
+type DeviceSchedule struct {
+	Params map[string]string
+}
+
+// RawParams guards access to arbitrary parameters. Entries are parameter IDs or glob
+// patterns, e.g. u8*.
+type RawParams struct {
+	// Allow lists parameters that can be read and written. If empty, parameters that aren't
+	// denied can be read, but none can be written.
+	Allow []string
+	Deny  []string
+}
+
+var (
+	// ErrNotAllowed is returned for raw parameters not permitted by RawParams.
+	ErrNotAllowed = errors.New("not allowed")
+	// ErrNotConfigured is returned for installations and devices missing in the config.
+	ErrNotConfigured = errors.New("not configured")
+)
+
+// CheckRead returns an error if any of the parameters can't be read.
+func (r RawParams) CheckRead(ids ...string) error {
+	for _, id := range ids {
+		if matchAny(r.Deny, id) || (len(r.Allow) > 0 && !matchAny(r.Allow, id)) {
+			return fmt.Errorf("reading parameter %s is %w", id, ErrNotAllowed)
+		}
+	}
+	return nil
+}
+
+// CheckWrite returns an error if any of the parameters can't be written.
+func (r RawParams) CheckWrite(ids ...string) error {
+	for _, id := range ids {
+		if matchAny(r.Deny, id) || !matchAny(r.Allow, id) {
+			return fmt.Errorf("writing parameter %s is %w", id, ErrNotAllowed)
+		}
+	}
+	return nil
+}
+
+func matchAny(patterns []string, id string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, id); ok {
+			return true
+		}
+	}
+	return false
 }
 
 type API struct {
 	Endpoint string
 
-	Rest  bool
-	Alexa bool
+	Rest      bool
+	Alexa     bool
+	SmartHome bool `mapstructure:"smart_home"`
+	Metrics   bool
+	// Debug serves the state of MQTT sessions and recent envelopes at /debug/econet.
+	Debug bool
+
+	TLS  TLS
+	Auth Auth
+}
+
+// TLS configures HTTPS serving of the API.
+type TLS struct {
+	// Cert and Key are paths of PEM files, reloaded when they change on disk.
+	Cert string
+	Key  string
+	// ClientCA is a path of PEM CA certificates verifying client certificates, required by
+	// api.auth.client_certs.
+	ClientCA string `mapstructure:"client_ca"`
+	// RedirectFrom is an address of a plain HTTP listener redirecting to HTTPS, e.g. 0.0.0.0:80.
+	RedirectFrom string `mapstructure:"redirect_from"`
+}
+
+// Enabled reports whether the API is served over HTTPS.
+func (t TLS) Enabled() bool {
+	return t.Cert != "" || t.Key != ""
+}
+
+// Scopes of API clients, control implies read.
+const (
+	ScopeRead    = "read"
+	ScopeControl = "control"
+)
+
+// Auth lists clients allowed to use the API. If it's empty, the API is open to anyone.
+type Auth struct {
+	// Tokens are sent as "Authorization: Bearer <token>".
+	Tokens []AuthToken
+	// Users authenticate with HTTP basic auth.
+	Users []AuthUser
+	// ClientCerts are matched by the common name of verified TLS client certificates.
+	ClientCerts []AuthClientCert `mapstructure:"client_certs"`
+}
+
+type AuthToken struct {
+	Name  string
+	Token string
+	Scope string
+}
+
+type AuthUser struct {
+	Username string
+	// PasswordHash is a bcrypt hash of the password, see "ventclear hash-password".
+	PasswordHash string `mapstructure:"password_hash"`
+	Scope        string
+}
+
+type AuthClientCert struct {
+	CommonName string `mapstructure:"common_name"`
+	Scope      string
+}
+
+// Enabled reports whether any clients are configured.
+func (a Auth) Enabled() bool {
+	return len(a.Tokens) > 0 || len(a.Users) > 0 || len(a.ClientCerts) > 0
+}
+
+func (a Auth) validate() error {
+	checkScope := func(kind, name, scope string) error {
+		if scope != ScopeRead && scope != ScopeControl {
+			return fmt.Errorf("%s %s: invalid scope %q, expected %s or %s", kind, name, scope, ScopeRead, ScopeControl)
+		}
+		return nil
+	}
+
+	for _, t := range a.Tokens {
+		if t.Token == "" {
+			return fmt.Errorf("token %s: empty token", t.Name)
+		}
+		if err := checkScope("token", t.Name, t.Scope); err != nil {
+			return err
+		}
+	}
+	for _, u := range a.Users {
+		if u.Username == "" || u.PasswordHash == "" {
+			return fmt.Errorf("user %s: username and password hash are required", u.Username)
+		}
+		if err := checkScope("user", u.Username, u.Scope); err != nil {
+			return err
+		}
+	}
+	for _, c := range a.ClientCerts {
+		if c.CommonName == "" {
+			return fmt.Errorf("client certificate: empty common name")
+		}
+		if err := checkScope("client certificate", c.CommonName, c.Scope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Storage configures where the application persists its state.
+type Storage struct {
+	Dir string
+}
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+type Log struct {
+	// Level is one of debug, info, warn or error, info by default.
+	Level string
+	// Format is text (default) or json.
+	Format string
+}
+
+func (l Log) validate() error {
+	var level slog.Level
+	if l.Level != "" {
+		if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+			return fmt.Errorf("invalid level %q, expected debug, info, warn or error", l.Level)
+		}
+	}
+	if l.Format != "" && l.Format != LogFormatText && l.Format != LogFormatJSON {
+		return fmt.Errorf("invalid format %q, expected %s or %s", l.Format, LogFormatText, LogFormatJSON)
+	}
+	return nil
+}
+
+const (
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+)
+
+type Tracing struct {
+	// Exporter is otlp or stdout, tracing is disabled if empty.
+	Exporter string
+	// Endpoint is the host:port of the OTLP/HTTP collector, OTEL_EXPORTER_OTLP_* environment variables apply if empty.
+	Endpoint string
+	// Insecure sends spans to the collector over plain HTTP.
+	Insecure bool
+}
+
+func (t Tracing) validate() error {
+	if t.Exporter != "" && t.Exporter != TracingExporterOTLP && t.Exporter != TracingExporterStdout {
+		return fmt.Errorf("invalid exporter %q, expected %s or %s", t.Exporter, TracingExporterOTLP, TracingExporterStdout)
+	}
+	if t.Endpoint != "" && t.Exporter != TracingExporterOTLP {
+		return fmt.Errorf("endpoint requires the %s exporter", TracingExporterOTLP)
+	}
+	return nil
 }
 
 type Alexa struct {
@@ -58,6 +397,8 @@ func LoadConfig() (*Config, error) {
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(".")
 
+	viper.SetDefault("storage.dir", ".")
+
 	if err := viper.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("viper.ReadInConfig failed: %w", err)
 	}
@@ -66,6 +407,10 @@ func LoadConfig() (*Config, error) {
 	if err := viper.Unmarshal(&c); err != nil {
 		return nil, fmt.Errorf("viper.Unmarshal failed: %w", err)
 	}
+
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
 	return &c, nil
 }
 
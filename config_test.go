@@ -0,0 +1,87 @@
+package spiroflex
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAllInstallations(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		expected []Installation
+	}{
+		{
+			name:   "single installation",
+			config: Config{Installation: Installation{Name: "Home"}},
+			expected: []Installation{
+				{Name: "Home", Devices: []Device{{Name: DefaultDeviceName, Component: DefaultComponent}}},
+			},
+		},
+		{
+			name: "installations with devices",
+			config: Config{
+				Installation: Installation{Name: "Home"},
+				Installations: []Installation{
+					{Name: "Home", Devices: []Device{{Name: "Attic", Component: "ecoVENT MAXI"}}},
+					{Name: "Cottage", Devices: []Device{{Name: "Cottage"}}},
+				},
+			},
+			expected: []Installation{
+				{Name: "Home", Devices: []Device{{Name: "Attic", Component: "ecoVENT MAXI"}}},
+				{Name: "Cottage", Devices: []Device{{Name: "Cottage", Component: DefaultComponent}}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installations := tt.config.AllInstallations()
+			if !reflect.DeepEqual(installations, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, installations)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := Config{
+		Installations: []Installation{
+			{Name: "Home"},
+			{Name: "Cottage"},
+		},
+	}
+	if err := c.validate(); err == nil {
+		t.Error("expected error for duplicate default device names")
+	}
+
+	c.Installations[1].Devices = []Device{{Name: "Cottage"}}
+	if err := c.validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRawParams(t *testing.T) {
+	tests := []struct {
+		name              string
+		guard             RawParams
+		id                string
+		canRead, canWrite bool
+	}{
+		{name: "no lists", id: "u81", canRead: true},
+		{name: "allowed", guard: RawParams{Allow: []string{"u8*"}}, id: "u81", canRead: true, canWrite: true},
+		{name: "not allowed", guard: RawParams{Allow: []string{"u8*"}}, id: "u6630"},
+		{name: "denied", guard: RawParams{Allow: []string{"u*"}, Deny: []string{"u7074"}}, id: "u7074"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.guard.CheckRead(tt.id); (err == nil) != tt.canRead {
+				t.Errorf("expected read allowed: %t, got error: %v", tt.canRead, err)
+			}
+			if err := tt.guard.CheckWrite(tt.id); (err == nil) != tt.canWrite {
+				t.Errorf("expected write allowed: %t, got error: %v", tt.canWrite, err)
+			}
+		})
+	}
+}
@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
 	signer "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/mtojek/spiroflex-vent-clear/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const payloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
@@ -21,18 +23,24 @@ type Installation struct {
 	IsConnected bool   `json:"isConnected"`
 }
 
-func (c *Client) Installations(ctx context.Context) ([]Installation, error) {
-	url := fmt.Sprintf("https://%s.execute-api.%s.amazonaws.com/Prod/get-installations", c.cfg.Gateway.Name, c.cfg.Region)
-	req, err := http.NewRequest("GET", url, nil)
+func (c *Client) Installations(ctx context.Context) (result []Installation, err error) {
+	ctx, span := tracer.Start(ctx, "econet.Installations", trace.WithSpanKind(trace.SpanKindClient))
+	defer func() { tracing.End(span, err) }()
+
+	endpoint := fmt.Sprintf("https://%s.execute-api.%s.amazonaws.com", c.cfg.Gateway.Name, c.cfg.Region)
+	if c.cfg.Endpoints.Gateway != "" {
+		endpoint = strings.TrimSuffix(c.cfg.Endpoints.Gateway, "/")
+	}
+
+	url := endpoint + "/Prod/get-installations"
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("new request failed: %w", err)
 	}
 
-	awsCreds := aws.Credentials{
-		AccessKeyID:     *c.creds.AccessKeyId,
-		SecretAccessKey: *c.creds.SecretKey,
-		SessionToken:    *c.creds.SessionToken,
-		Source:          "CognitoIdentity",
+	awsCreds, err := c.creds.Credentials(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to obtain credentials: %w", ErrAuthFailed, err)
 	}
 
 	s := signer.NewSigner()
@@ -40,18 +48,20 @@ func (c *Client) Installations(ctx context.Context) ([]Installation, error) {
 		return nil, fmt.Errorf("sign HTTP failed: %w", err)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.http.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("HTTP request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("%w: unexpected status %s", ErrAuthFailed, resp.Status)
+	}
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, string(body))
 	}
 
-	var result []Installation
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, fmt.Errorf("JSON unmarshal failed: %w", err)
 	}
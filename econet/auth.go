@@ -3,59 +3,202 @@ package econet
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"sync"
 	"time"
 
 	cognitosrp "github.com/alexrudd/cognito-srp/v4"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cognitoidentity"
-	cognitotypes "github.com/aws/aws-sdk-go-v2/service/cognitoidentity/types"
 	cip "github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
 	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
 	"github.com/mtojek/spiroflex-vent-clear"
+	"github.com/mtojek/spiroflex-vent-clear/metrics"
+	"github.com/mtojek/spiroflex-vent-clear/tracing"
+	"golang.org/x/sync/singleflight"
 )
 
-func auth(ctx context.Context, c *spiroflex.Config) (string, *cognitotypes.Credentials, error) {
-	awsCfg, err := spiroflex.LoadAWSConfig(ctx, c)
+// credentialsRefreshMargin defines how long before the expiry tokens and credentials are renewed.
+const credentialsRefreshMargin = 5 * time.Minute
+
+type tokens struct {
+	idToken      string
+	refreshToken string
+	expiresAt    time.Time
+}
+
+// cognitoCredentials authenticates the Cognito user and exchanges its tokens for AWS credentials.
+type cognitoCredentials struct {
+	cfg    *spiroflex.Config
+	awsCfg aws.Config
+
+	// renewals deduplicates concurrent renewals, which run without m held.
+	renewals singleflight.Group
+
+	// m guards the fields below, it's never held during network calls.
+	m          sync.Mutex
+	identityID string
+	tokens     *tokens
+	creds      aws.Credentials
+}
+
+func newCognitoCredentials(ctx context.Context, cfg *spiroflex.Config) (*cognitoCredentials, error) {
+	awsCfg, err := spiroflex.LoadAWSConfig(ctx, cfg)
 	if err != nil {
-		return "", nil, fmt.Errorf("unable to load AWS config: %w", err)
+		return nil, fmt.Errorf("unable to load AWS config: %w", err)
 	}
 
-	authResult, err := cognitoAuthenticate(ctx, c, *awsCfg)
-	if err != nil {
-		return "", nil, fmt.Errorf("Cognito authentication failed: %w", err)
+	c := &cognitoCredentials{
+		cfg:    cfg,
+		awsCfg: *awsCfg,
 	}
-	idToken := *authResult.IdToken
+	if _, err := c.Credentials(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
 
-	ci := cognitoidentity.NewFromConfig(*awsCfg)
-	provider := fmt.Sprintf("cognito-idp.%s.amazonaws.com/%s", c.Region, c.Cognito.UserPoolID)
+func (c *cognitoCredentials) IdentityID() string {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.identityID
+}
+
+// CachedCredentials returns the credentials last obtained, they may have expired.
+func (c *cognitoCredentials) CachedCredentials() aws.Credentials {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.creds
+}
+
+func (c *cognitoCredentials) Credentials(ctx context.Context) (aws.Credentials, error) {
+	c.m.Lock()
+	creds := c.creds
+	c.m.Unlock()
+
+	// Credentials without an expiration are valid as long as the identity.
+	if creds.HasKeys() && !(creds.CanExpire && expiresSoon(creds.Expires)) {
+		return creds, nil
+	}
 
-	idResp, err := ci.GetId(ctx, &cognitoidentity.GetIdInput{
-		IdentityPoolId: aws.String(c.Cognito.IdentityPoolID),
-		Logins:         map[string]string{provider: idToken},
+	v, err, _ := c.renewals.Do("credentials", func() (any, error) {
+		return c.renew(ctx)
 	})
 	if err != nil {
-		return "", nil, fmt.Errorf("unable to get Cognito ID: %w", err)
+		return aws.Credentials{}, err
+	}
+	return v.(aws.Credentials), nil
+}
+
+// renew obtains new AWS credentials, refreshing the Cognito tokens if needed.
+func (c *cognitoCredentials) renew(ctx context.Context) (creds aws.Credentials, err error) {
+	ctx, span := tracer.Start(ctx, "econet.auth")
+	defer func() { tracing.End(span, err) }()
+
+	c.m.Lock()
+	t, identityID := c.tokens, c.identityID
+	c.m.Unlock()
+
+	if t == nil || expiresSoon(t.expiresAt) {
+		t, err = c.refreshTokens(ctx, t)
+		if err != nil {
+			return aws.Credentials{}, err
+		}
+		c.m.Lock()
+		c.tokens = t
+		c.m.Unlock()
+	}
+
+	identityID, creds, err = identityCredentials(ctx, c.cfg, c.awsCfg, identityID, t.idToken)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.identityID = identityID
+	c.creds = creds
+	return creds, nil
+}
+
+func (c *cognitoCredentials) refreshTokens(ctx context.Context, current *tokens) (*tokens, error) {
+	if current != nil && current.refreshToken != "" {
+		metrics.CognitoAuthAttempts.WithLabelValues("refresh").Inc()
+		t, err := cognitoRefresh(ctx, c.cfg, c.awsCfg, current.refreshToken)
+		if err == nil {
+			return t, nil
+		}
+		metrics.CognitoAuthFailures.WithLabelValues("refresh").Inc()
+		slog.Warn("Cognito token refresh failed, falling back to SRP authentication", "error", err)
+	}
+
+	metrics.CognitoAuthAttempts.WithLabelValues("srp").Inc()
+	t, err := cognitoAuthenticate(ctx, c.cfg, c.awsCfg)
+	if err != nil {
+		metrics.CognitoAuthFailures.WithLabelValues("srp").Inc()
+		return nil, fmt.Errorf("Cognito authentication failed: %w", err)
 	}
+	return t, nil
+}
 
-	identityID := *idResp.IdentityId
+func expiresSoon(t time.Time) bool {
+	return time.Until(t) < credentialsRefreshMargin
+}
+
+func identityCredentials(ctx context.Context, c *spiroflex.Config, awsCfg aws.Config, identityID, idToken string) (string, aws.Credentials, error) {
+	ci := cognitoidentity.NewFromConfig(awsCfg, func(o *cognitoidentity.Options) {
+		if c.Endpoints.CognitoIdentity != "" {
+			o.BaseEndpoint = aws.String(c.Endpoints.CognitoIdentity)
+		}
+	})
+	provider := fmt.Sprintf("cognito-idp.%s.amazonaws.com/%s", c.Region, c.Cognito.UserPoolID)
+
+	if identityID == "" {
+		idResp, err := ci.GetId(ctx, &cognitoidentity.GetIdInput{
+			IdentityPoolId: aws.String(c.Cognito.IdentityPoolID),
+			Logins:         map[string]string{provider: idToken},
+		})
+		if err != nil {
+			return "", aws.Credentials{}, fmt.Errorf("unable to get Cognito ID: %w", err)
+		}
+		identityID = *idResp.IdentityId
+	}
 
 	credsResp, err := ci.GetCredentialsForIdentity(ctx, &cognitoidentity.GetCredentialsForIdentityInput{
 		IdentityId: aws.String(identityID),
 		Logins:     map[string]string{provider: idToken},
 	})
 	if err != nil {
-		return "", nil, fmt.Errorf("unable to get Cognito credentials: %w", err)
+		return "", aws.Credentials{}, fmt.Errorf("unable to get Cognito credentials: %w", err)
+	}
+
+	creds := credsResp.Credentials
+	awsCreds := aws.Credentials{
+		AccessKeyID:     aws.ToString(creds.AccessKeyId),
+		SecretAccessKey: aws.ToString(creds.SecretKey),
+		SessionToken:    aws.ToString(creds.SessionToken),
+		Source:          "CognitoIdentity",
+	}
+	if creds.Expiration != nil {
+		awsCreds.CanExpire = true
+		awsCreds.Expires = *creds.Expiration
 	}
-	return identityID, credsResp.Credentials, nil
+	return identityID, awsCreds, nil
 }
 
-func cognitoAuthenticate(ctx context.Context, c *spiroflex.Config, awsCfg aws.Config) (*types.AuthenticationResultType, error) {
+func cognitoAuthenticate(ctx context.Context, c *spiroflex.Config, awsCfg aws.Config) (t *tokens, err error) {
+	ctx, span := tracer.Start(ctx, "econet.cognitoAuthenticate")
+	defer func() { tracing.End(span, err) }()
+
 	srp, err := initSRP(c)
 	if err != nil {
 		return nil, fmt.Errorf("initiate SRP failed: %w", err)
 	}
 
-	cipClient := cip.NewFromConfig(awsCfg)
+	cipClient := newCIPClient(c, awsCfg)
 	initResp, err := cipClient.InitiateAuth(ctx, &cip.InitiateAuthInput{
 		AuthFlow:       types.AuthFlowTypeUserSrpAuth,
 		ClientId:       aws.String(srp.GetClientId()),
@@ -82,9 +225,49 @@ func cognitoAuthenticate(ctx context.Context, c *spiroflex.Config, awsCfg aws.Co
 	if err != nil {
 		return nil, fmt.Errorf("respond to auth challenge failed: %w", err)
 	}
+	return newTokens(resp.AuthenticationResult, "")
+}
 
-	tokens := resp.AuthenticationResult
-	return tokens, nil
+func cognitoRefresh(ctx context.Context, c *spiroflex.Config, awsCfg aws.Config, refreshToken string) (t *tokens, err error) {
+	ctx, span := tracer.Start(ctx, "econet.cognitoRefresh")
+	defer func() { tracing.End(span, err) }()
+
+	cipClient := newCIPClient(c, awsCfg)
+	resp, err := cipClient.InitiateAuth(ctx, &cip.InitiateAuthInput{
+		AuthFlow: types.AuthFlowTypeRefreshTokenAuth,
+		ClientId: aws.String(c.Cognito.ClientID),
+		AuthParameters: map[string]string{
+			"REFRESH_TOKEN": refreshToken,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("initiate auth failed: %w", err)
+	}
+	return newTokens(resp.AuthenticationResult, refreshToken)
+}
+
+func newCIPClient(c *spiroflex.Config, awsCfg aws.Config) *cip.Client {
+	return cip.NewFromConfig(awsCfg, func(o *cip.Options) {
+		if c.Endpoints.CognitoIDP != "" {
+			o.BaseEndpoint = aws.String(c.Endpoints.CognitoIDP)
+		}
+	})
+}
+
+func newTokens(result *types.AuthenticationResultType, refreshToken string) (*tokens, error) {
+	if result == nil || result.IdToken == nil {
+		return nil, fmt.Errorf("authentication result is missing ID token")
+	}
+
+	// The refresh token is not reissued by the REFRESH_TOKEN_AUTH flow.
+	if result.RefreshToken != nil {
+		refreshToken = *result.RefreshToken
+	}
+	return &tokens{
+		idToken:      *result.IdToken,
+		refreshToken: refreshToken,
+		expiresAt:    time.Now().Add(time.Duration(result.ExpiresIn) * time.Second),
+	}, nil
 }
 
 func initSRP(c *spiroflex.Config) (*cognitosrp.CognitoSRP, error) {
@@ -96,7 +279,7 @@ func initSRP(c *spiroflex.Config) (*cognitosrp.CognitoSRP, error) {
 		nil,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("cognitosrp.NewCognitoSRP failed: %v", srp)
+		return nil, fmt.Errorf("cognitosrp.NewCognitoSRP failed: %w", err)
 	}
 	return srp, nil
 }
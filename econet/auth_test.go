@@ -0,0 +1,107 @@
+package econet_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+	"github.com/mtojek/spiroflex-vent-clear/fakeaws"
+)
+
+func newFakeAWS(t *testing.T, ttl time.Duration, configure ...func(o *fakeaws.Options)) (*fakeaws.Server, *spiroflex.Config) {
+	t.Helper()
+
+	c := &spiroflex.Config{
+		Region: "eu-west-3",
+		Cognito: spiroflex.CognitoConfig{
+			Username:       "user@example.com",
+			Password:       "fake-password",
+			UserPoolID:     "eu-west-3_examplePool",
+			ClientID:       "client",
+			IdentityPoolID: "eu-west-3:identity-pool",
+		},
+	}
+
+	opts := fakeaws.Options{
+		Region:         c.Region,
+		UserPoolID:     c.Cognito.UserPoolID,
+		ClientID:       c.Cognito.ClientID,
+		IdentityPoolID: c.Cognito.IdentityPoolID,
+		Username:       c.Cognito.Username,
+		Password:       c.Cognito.Password,
+		Installations:  []econet.Installation{{ID: "installation-1", Name: "Home"}},
+		TokenTTL:       ttl,
+		CredentialsTTL: ttl,
+	}
+	for _, f := range configure {
+		f(&opts)
+	}
+	s := fakeaws.NewServer(opts)
+	t.Cleanup(s.Close)
+
+	c.Endpoints = spiroflex.Endpoints{
+		CognitoIDP:      s.URL,
+		CognitoIdentity: s.URL,
+		Gateway:         s.URL,
+	}
+	return s, c
+}
+
+func TestAuthenticationWrongPassword(t *testing.T) {
+	_, c := newFakeAWS(t, time.Hour)
+	c.Cognito.Password = "wrong-password"
+
+	_, err := econet.New(context.Background(), c)
+	if !errors.Is(err, econet.ErrAuthFailed) {
+		t.Fatalf("expected ErrAuthFailed, got %v", err)
+	}
+}
+
+func TestCredentialsRefresh(t *testing.T) {
+	tests := []struct {
+		name                string
+		ttl                 time.Duration
+		noExpiration        bool
+		expectedRefreshes   int
+		expectedCredentials int
+	}{
+		{name: "long-lived credentials", ttl: time.Hour, expectedRefreshes: 0, expectedCredentials: 1},
+		{name: "credentials expiring soon", ttl: time.Minute, expectedRefreshes: 2, expectedCredentials: 3},
+		{name: "credentials without expiration", ttl: time.Minute, noExpiration: true, expectedRefreshes: 0, expectedCredentials: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, c := newFakeAWS(t, tt.ttl, func(o *fakeaws.Options) { o.NoCredentialsExpiration = tt.noExpiration })
+			ctx := context.Background()
+
+			client, err := econet.New(ctx, c)
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+
+			for range 2 {
+				installations, err := client.Installations(ctx)
+				if err != nil {
+					t.Fatalf("Installations failed: %v", err)
+				}
+				if len(installations) != 1 {
+					t.Fatalf("unexpected installations: %+v", installations)
+				}
+			}
+
+			if logins := s.SRPLogins(); logins != 1 {
+				t.Errorf("expected a single SRP login, got %d", logins)
+			}
+			if refreshes := s.Refreshes(); refreshes != tt.expectedRefreshes {
+				t.Errorf("expected %d refreshes, got %d", tt.expectedRefreshes, refreshes)
+			}
+			if issued := s.CredentialsIssued(); issued != tt.expectedCredentials {
+				t.Errorf("expected %d credentials, got %d", tt.expectedCredentials, issued)
+			}
+		})
+	}
+}
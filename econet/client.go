@@ -4,26 +4,30 @@ import (
 	"context"
 	"fmt"
 
-	cognitotypes "github.com/aws/aws-sdk-go-v2/service/cognitoidentity/types"
 	"github.com/mtojek/spiroflex-vent-clear"
 )
 
 type Client struct {
 	cfg *spiroflex.Config
 
-	identityID string
-	creds      *cognitotypes.Credentials
+	creds  CredentialsProvider
+	http   HTTPDoer
+	dialer Dialer
 }
 
 func New(ctx context.Context, cfg *spiroflex.Config) (*Client, error) {
-	identityID, creds, err := auth(ctx, cfg)
+	t, err := AWSTransport(ctx, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("unable to authenticate the client: %v", err)
+		return nil, fmt.Errorf("%w: %w", ErrAuthFailed, err)
 	}
+	return NewWithTransport(cfg, *t), nil
+}
 
+func NewWithTransport(cfg *spiroflex.Config, t Transport) *Client {
 	return &Client{
-		cfg:        cfg,
-		identityID: identityID,
-		creds:      creds,
-	}, nil
+		cfg:    cfg,
+		creds:  t.Credentials,
+		http:   t.HTTP,
+		dialer: t.MQTT,
+	}
 }
@@ -0,0 +1,166 @@
+package econet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// envelopeHistorySize limits the envelopes each session keeps for diagnostics.
+const envelopeHistorySize = 20
+
+const (
+	DirectionRequest  = "request"
+	DirectionResponse = "response"
+)
+
+// Envelope is an installation request or response exchanged over MQTT.
+type Envelope struct {
+	Time          time.Time       `json:"time"`
+	Direction     string          `json:"direction"`
+	Topic         string          `json:"topic"`
+	TransactionID string          `json:"transaction_id,omitempty"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// envelopeHistory keeps the most recent envelopes of a session.
+type envelopeHistory struct {
+	m         sync.Mutex
+	envelopes []Envelope
+}
+
+func (h *envelopeHistory) add(direction, topic, transactionID string, payload []byte) {
+	if !json.Valid(payload) {
+		payload, _ = json.Marshal(string(payload))
+	}
+	e := Envelope{
+		Time:          time.Now(),
+		Direction:     direction,
+		Topic:         topic,
+		TransactionID: transactionID,
+		Payload:       append(json.RawMessage(nil), payload...),
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.envelopes = append(h.envelopes, e)
+	if len(h.envelopes) > envelopeHistorySize {
+		h.envelopes = append([]Envelope(nil), h.envelopes[len(h.envelopes)-envelopeHistorySize:]...)
+	}
+}
+
+func (h *envelopeHistory) list() []Envelope {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return append([]Envelope{}, h.envelopes...)
+}
+
+// SessionDiagnostics describes the state of an MQTT session.
+type SessionDiagnostics struct {
+	InstallationID string `json:"installation_id"`
+	ClientID       string `json:"client_id"`
+	Connected      bool   `json:"connected"`
+	// CredentialsExpireAt is the expiry of credentials used to open the connection.
+	CredentialsExpireAt *time.Time `json:"credentials_expire_at,omitempty"`
+	Topics              []string   `json:"topics"`
+	PendingTransactions int        `json:"pending_transactions"`
+	// Envelopes are the most recent requests and responses, the oldest first.
+	Envelopes []Envelope `json:"envelopes"`
+	// State is the last known parameter values of components by their ID, reported in
+	// responses and notifications. It's filled in by the manager.
+	State map[string]ComponentState `json:"state,omitempty"`
+}
+
+// Diagnostics returns the state of the session.
+func (s *MQTTSession) Diagnostics() SessionDiagnostics {
+	d := SessionDiagnostics{
+		InstallationID: s.installationID,
+		ClientID:       s.clientID,
+		Connected:      s.IsConnected(),
+		Topics:         []string{s.responseTopic()},
+		Envelopes:      s.history.list(),
+	}
+	if expiresAt := s.client.ExpiresAt(); !expiresAt.IsZero() {
+		d.CredentialsExpireAt = &expiresAt
+	}
+
+	s.m.Lock()
+	d.PendingTransactions = len(s.pending)
+	s.m.Unlock()
+
+	s.hm.Lock()
+	for topic := range s.handlers {
+		d.Topics = append(d.Topics, topic)
+	}
+	s.hm.Unlock()
+	sort.Strings(d.Topics[1:])
+	return d
+}
+
+// Diagnostics describes the state of the client and its sessions.
+type Diagnostics struct {
+	Authenticated bool   `json:"authenticated"`
+	IdentityID    string `json:"identity_id,omitempty"`
+	// CredentialsExpireAt is the expiry of the AWS credentials last obtained for the Cognito identity.
+	CredentialsExpireAt *time.Time           `json:"credentials_expire_at,omitempty"`
+	Sessions            []SessionDiagnostics `json:"sessions"`
+}
+
+// cachedCredentials is implemented by credentials providers that can return their
+// credentials without renewing them.
+type cachedCredentials interface {
+	CachedCredentials() aws.Credentials
+}
+
+// Diagnostics returns the state of the client and all sessions. It makes no network calls,
+// the credentials are neither obtained nor renewed.
+func (m *Manager) Diagnostics() Diagnostics {
+	m.m.Lock()
+	client := m.client
+	sessions := make([]*MQTTSession, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		sessions = append(sessions, session)
+	}
+	m.m.Unlock()
+
+	d := Diagnostics{Sessions: []SessionDiagnostics{}}
+	if client != nil {
+		d.Authenticated = true
+		d.IdentityID = client.creds.IdentityID()
+
+		if cached, ok := client.creds.(cachedCredentials); ok {
+			if creds := cached.CachedCredentials(); creds.CanExpire {
+				d.CredentialsExpireAt = &creds.Expires
+			}
+		}
+	}
+
+	for _, session := range sessions {
+		sd := session.Diagnostics()
+		sd.State = m.state.Components(session.installationID)
+		d.Sessions = append(d.Sessions, sd)
+	}
+	sort.Slice(d.Sessions, func(i, j int) bool {
+		return d.Sessions[i].InstallationID < d.Sessions[j].InstallationID
+	})
+	return d
+}
+
+// CheckCredentials verifies the Cognito credentials are valid, renewing them if needed.
+func (m *Manager) CheckCredentials(ctx context.Context) error {
+	client, err := m.getClient(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := client.creds.Credentials(ctx); err != nil {
+		return fmt.Errorf("%w: %w", ErrAuthFailed, err)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package econet_test
+
+import (
+	"testing"
+
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+	"github.com/mtojek/spiroflex-vent-clear/econet/econettest"
+)
+
+func TestSessionDiagnostics(t *testing.T) {
+	broker := econettest.NewBroker()
+	broker.Handle(econettest.Respond(func(ops []econet.OperationRequest) []econet.OperationResponse {
+		return []econet.OperationResponse{{Name: econet.GET_COMPONENTS_ON_BUS}}
+	}))
+	session := newTestSession(t, broker)
+
+	for i := 0; i < 15; i++ {
+		_, err := session.SendInstallationRequest(testContext(t), []econet.OperationRequest{{Name: econet.GET_COMPONENTS_ON_BUS}})
+		if err != nil {
+			t.Fatalf("SendInstallationRequest failed: %v", err)
+		}
+	}
+
+	d := session.Diagnostics()
+	if !d.Connected || d.InstallationID != testInstallationID || d.PendingTransactions != 0 {
+		t.Errorf("unexpected diagnostics: %+v", d)
+	}
+
+	// Only the most recent envelopes are kept.
+	if len(d.Envelopes) != 20 {
+		t.Fatalf("expected 20 envelopes, got %d", len(d.Envelopes))
+	}
+	first, last := d.Envelopes[0], d.Envelopes[len(d.Envelopes)-1]
+	if first.Direction != econet.DirectionRequest || first.TransactionID != "6" {
+		t.Errorf("expected request of transaction 6 first, got %s of %s", first.Direction, first.TransactionID)
+	}
+	if last.Direction != econet.DirectionResponse || last.TransactionID != "15" {
+		t.Errorf("expected response of transaction 15 last, got %s of %s", last.Direction, last.TransactionID)
+	}
+}
@@ -0,0 +1,333 @@
+// Package econettest provides in-memory fakes of the econet transport.
+package econettest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+)
+
+// Credentials is a static econet.CredentialsProvider.
+type Credentials struct {
+	Identity string
+	Creds    aws.Credentials
+	Err      error
+}
+
+func (c *Credentials) Credentials(ctx context.Context) (aws.Credentials, error) {
+	return c.Creds, c.Err
+}
+
+func (c *Credentials) IdentityID() string {
+	return c.Identity
+}
+
+// StaticCredentials returns credentials which never expire.
+func StaticCredentials() *Credentials {
+	return &Credentials{
+		Identity: "eu-west-3:00000000-0000-0000-0000-000000000000",
+		Creds: aws.Credentials{
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "secret",
+			SessionToken:    "token",
+		},
+	}
+}
+
+// HTTPFunc is an econet.HTTPDoer implemented by a function.
+type HTTPFunc func(req *http.Request) (*http.Response, error)
+
+func (f HTTPFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// InstallationsAPI serves the given installations on every request.
+func InstallationsAPI(installations ...econet.Installation) HTTPFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		body, err := json.Marshal(installations)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{
+			Status:     "200 OK",
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(bytes.NewReader(body)),
+		}, nil
+	}
+}
+
+// Message is a message published on the broker.
+type Message struct {
+	Topic   string
+	Payload []byte
+}
+
+// RequestHandler processes a message published by a client.
+type RequestHandler func(b *Broker, msg Message)
+
+// Broker is an in-memory MQTT broker implementing econet.Dialer. Topics are matched exactly.
+type Broker struct {
+	m         sync.Mutex
+	conns     []*Conn
+	handler   RequestHandler
+	published []Message
+	dialErr   error
+	expiresAt time.Time
+}
+
+func NewBroker() *Broker {
+	return &Broker{}
+}
+
+// Handle sets the handler called asynchronously for every message published by clients.
+func (b *Broker) Handle(h RequestHandler) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.handler = h
+}
+
+// FailDial makes subsequent dials fail with the error.
+func (b *Broker) FailDial(err error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.dialErr = err
+}
+
+// ExpireAt sets the expiry of credentials of subsequent connections.
+func (b *Broker) ExpireAt(t time.Time) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.expiresAt = t
+}
+
+func (b *Broker) Dial(ctx context.Context, clientID string, events econet.ConnectionEvents) (econet.PubSub, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.dialErr != nil {
+		return nil, b.dialErr
+	}
+
+	c := &Conn{
+		broker:   b,
+		clientID: clientID,
+		events:   events,
+		subs:     map[string]func(topic string, payload []byte){},
+		open:     true,
+
+		expiresAt: b.expiresAt,
+	}
+	b.conns = append(b.conns, c)
+	return c, nil
+}
+
+// Published returns messages published by clients.
+func (b *Broker) Published() []Message {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	return append([]Message(nil), b.published...)
+}
+
+// Subscriptions returns sorted topics subscribed by open connections.
+func (b *Broker) Subscriptions() []string {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	var topics []string
+	for _, c := range b.conns {
+		c.m.Lock()
+		if c.open {
+			for topic := range c.subs {
+				topics = append(topics, topic)
+			}
+		}
+		c.m.Unlock()
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// Publish delivers the message to subscribed clients.
+func (b *Broker) Publish(topic string, payload []byte) {
+	b.m.Lock()
+	var handlers []func(topic string, payload []byte)
+	for _, c := range b.conns {
+		c.m.Lock()
+		if h, ok := c.subs[topic]; ok && c.open {
+			handlers = append(handlers, h)
+		}
+		c.m.Unlock()
+	}
+	b.m.Unlock()
+
+	for _, h := range handlers {
+		h(topic, payload)
+	}
+}
+
+// DropConnections closes all open connections as if the network failed.
+func (b *Broker) DropConnections(err error) {
+	b.drop(err, false)
+}
+
+// Interrupt closes all open connections as if the network failed, but the clients keep
+// reconnecting, like paho with auto-reconnect, until Reconnect is called.
+func (b *Broker) Interrupt(err error) {
+	b.drop(err, true)
+}
+
+// Reconnect reopens interrupted connections. Subscriptions aren't restored, like with a
+// clean session, so clients have to subscribe again.
+func (b *Broker) Reconnect() {
+	b.m.Lock()
+	conns := append([]*Conn(nil), b.conns...)
+	b.m.Unlock()
+
+	for _, c := range conns {
+		c.m.Lock()
+		wasReconnecting := c.reconnecting
+		if wasReconnecting {
+			c.open, c.reconnecting = true, false
+			c.subs = map[string]func(topic string, payload []byte){}
+		}
+		c.m.Unlock()
+
+		if wasReconnecting && c.events.OnReconnect != nil {
+			c.events.OnReconnect()
+		}
+	}
+}
+
+func (b *Broker) drop(err error, reconnect bool) {
+	b.m.Lock()
+	conns := append([]*Conn(nil), b.conns...)
+	b.m.Unlock()
+
+	for _, c := range conns {
+		c.m.Lock()
+		wasOpen := c.open
+		c.open = false
+		c.reconnecting = wasOpen && reconnect
+		c.m.Unlock()
+
+		if wasOpen && c.events.OnConnectionLost != nil {
+			c.events.OnConnectionLost(err)
+		}
+	}
+}
+
+func (b *Broker) received(msg Message) {
+	b.m.Lock()
+	b.published = append(b.published, msg)
+	h := b.handler
+	b.m.Unlock()
+
+	if h != nil {
+		go h(b, msg)
+	}
+}
+
+// Conn is a client connection to the Broker implementing econet.PubSub.
+type Conn struct {
+	broker   *Broker
+	clientID string
+	events   econet.ConnectionEvents
+
+	m            sync.Mutex
+	subs         map[string]func(topic string, payload []byte)
+	open         bool
+	reconnecting bool
+
+	expiresAt time.Time
+}
+
+func (c *Conn) Publish(topic string, payload []byte) error {
+	if !c.IsConnectionOpen() {
+		return errors.New("connection closed")
+	}
+	c.broker.received(Message{Topic: topic, Payload: payload})
+	return nil
+}
+
+func (c *Conn) Subscribe(topic string, handler func(topic string, payload []byte)) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if !c.open {
+		return errors.New("connection closed")
+	}
+	c.subs[topic] = handler
+	return nil
+}
+
+func (c *Conn) IsConnectionOpen() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.open
+}
+
+func (c *Conn) IsConnected() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.open || c.reconnecting
+}
+
+func (c *Conn) ExpiresAt() time.Time {
+	return c.expiresAt
+}
+
+func (c *Conn) Disconnect() {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.open = false
+	c.reconnecting = false
+}
+
+// Respond returns a RequestHandler answering installation requests with operations returned by fn.
+func Respond(fn func(ops []econet.OperationRequest) []econet.OperationResponse) RequestHandler {
+	return func(b *Broker, msg Message) {
+		topic, ok := strings.CutSuffix(msg.Topic, "/installationRequest")
+		if !ok {
+			return
+		}
+
+		var req struct {
+			TransactionID string                    `json:"transactionId"`
+			Operations    []econet.OperationRequest `json:"operations,omitempty"`
+		}
+		if err := json.Unmarshal(msg.Payload, &req); err != nil {
+			panic(fmt.Sprintf("invalid installation request: %v", err))
+		}
+
+		resp, err := json.Marshal(struct {
+			TransactionID string                     `json:"transactionId"`
+			Operations    []econet.OperationResponse `json:"operations,omitempty"`
+		}{
+			TransactionID: req.TransactionID,
+			Operations:    fn(req.Operations),
+		})
+		if err != nil {
+			panic(fmt.Sprintf("can't marshal installation response: %v", err))
+		}
+		b.Publish(topic+"/installationResponse", resp)
+	}
+}
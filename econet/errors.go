@@ -0,0 +1,33 @@
+package econet
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrAuthFailed is returned when the account can't be authenticated or its credentials are rejected.
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrInstallationNotFound is returned for installations not available to the account.
+	ErrInstallationNotFound = errors.New("installation not found")
+	// ErrComponentNotFound is returned for components missing on the bus of the installation.
+	ErrComponentNotFound = errors.New("component not found")
+	// ErrAmbiguousComponent is returned when several components on the bus have the name of the device.
+	ErrAmbiguousComponent = errors.New("ambiguous component")
+	// ErrDeviceOffline is returned when the installation isn't connected to the cloud.
+	ErrDeviceOffline = errors.New("device is offline")
+	// ErrTimeout is returned when the device doesn't respond in time.
+	ErrTimeout = errors.New("timeout waiting for response")
+	// ErrInvalidValue is returned for parameter values the device wouldn't accept.
+	ErrInvalidValue = errors.New("invalid value")
+)
+
+// StatusError is returned when the device rejects an operation with a non-zero status code.
+type StatusError struct {
+	Operation  string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s failed, status code: %d", e.Operation, e.StatusCode)
+}
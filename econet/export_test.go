@@ -0,0 +1,8 @@
+package econet
+
+var VerifyParamsModificationStatus = verifyParamsModificationStatus
+
+// OnTransactionalMessage exposes the installationResponse handler of the session.
+func (s *MQTTSession) OnTransactionalMessage(topic string, payload []byte) {
+	s.onTransactionalMessage(topic, payload)
+}
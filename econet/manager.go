@@ -0,0 +1,330 @@
+package econet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrShutdown is returned by the manager after Shutdown.
+var ErrShutdown = errors.New("session manager is shut down")
+
+const (
+	// connectTimeout limits authentication, fetching installations and opening an MQTT session.
+	connectTimeout = 30 * time.Second
+	// discoveryTimeout limits fetching components on the bus of an installation.
+	discoveryTimeout = 15 * time.Second
+)
+
+// Manager keeps a single authenticated client and one MQTT session per installation,
+// so they can be shared by concurrent callers.
+type Manager struct {
+	cfg       *spiroflex.Config
+	newClient func(ctx context.Context) (*Client, error)
+
+	// m guards the fields below, it's never held during network calls.
+	m               sync.Mutex
+	client          *Client
+	sessions        map[string]*MQTTSession
+	installationIDs map[string]string
+	components      map[string]string
+	shutdown        bool
+
+	// calls deduplicates concurrent authentication, connects and discovery.
+	calls singleflight.Group
+
+	// state keeps parameter values reported by the sessions, shown in Diagnostics.
+	state *DeviceState
+}
+
+func NewManager(cfg *spiroflex.Config) *Manager {
+	m := newManager(cfg)
+	m.newClient = func(ctx context.Context) (*Client, error) {
+		return New(ctx, cfg)
+	}
+	return m
+}
+
+// NewManagerWithTransport returns a manager whose client uses the transport.
+func NewManagerWithTransport(cfg *spiroflex.Config, t Transport) *Manager {
+	m := newManager(cfg)
+	m.newClient = func(ctx context.Context) (*Client, error) {
+		return NewWithTransport(cfg, t), nil
+	}
+	return m
+}
+
+func newManager(cfg *spiroflex.Config) *Manager {
+	return &Manager{
+		cfg:             cfg,
+		sessions:        map[string]*MQTTSession{},
+		installationIDs: map[string]string{},
+		components:      map[string]string{},
+
+		state: NewDeviceState(),
+	}
+}
+
+// Installations returns installations of the account.
+func (m *Manager) Installations(ctx context.Context) ([]Installation, error) {
+	client, err := m.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+
+	installations, err := client.Installations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch installations: %w", err)
+	}
+	return installations, nil
+}
+
+// Components returns components on the bus of the installation, addressed by its name or ID.
+func (m *Manager) Components(ctx context.Context, installation string) ([]ComponentOnBus, error) {
+	session, err := m.session(ctx, installation)
+	if err != nil {
+		return nil, err
+	}
+	return m.componentsOnBus(ctx, session)
+}
+
+// Session returns a connected session for the installation, addressed by its name or ID.
+func (m *Manager) Session(ctx context.Context, installation string) (*MQTTSession, error) {
+	return m.session(ctx, installation)
+}
+
+// Target returns a connected session for the installation, addressed by its name or ID,
+// and the ID of the device's component on its bus. The component is matched by its ID if
+// configured, by its name otherwise.
+func (m *Manager) Target(ctx context.Context, installationName string, device spiroflex.Device) (*MQTTSession, string, error) {
+	session, err := m.session(ctx, installationName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := session.installationID + "/" + device.Component + "/" + device.ComponentID
+	m.m.Lock()
+	componentID, ok := m.components[key]
+	m.m.Unlock()
+	if ok {
+		return session, componentID, nil
+	}
+
+	gcob, err := m.componentsOnBus(ctx, session)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var matches []string
+	for _, c := range gcob {
+		if device.ComponentID != "" && c.ComponentID == device.ComponentID ||
+			device.ComponentID == "" && c.ComponentName == device.Component {
+			matches = append(matches, c.ComponentID)
+		}
+	}
+	switch {
+	case len(matches) == 0 && device.ComponentID != "":
+		return nil, "", fmt.Errorf("%w: ID %s on the bus of installation %s", ErrComponentNotFound, device.ComponentID, installationName)
+	case len(matches) == 0:
+		return nil, "", fmt.Errorf("%w: %q on the bus of installation %s", ErrComponentNotFound, device.Component, installationName)
+	case len(matches) > 1:
+		return nil, "", fmt.Errorf("%w: %q on the bus of installation %s has IDs %s, configure the component ID of device %s",
+			ErrAmbiguousComponent, device.Component, installationName, strings.Join(matches, ", "), device.Name)
+	}
+	componentID = matches[0]
+
+	m.m.Lock()
+	m.components[key] = componentID
+	m.m.Unlock()
+	return session, componentID, nil
+}
+
+// componentsOnBus fetches components on the bus, sharing the request between concurrent callers.
+func (m *Manager) componentsOnBus(ctx context.Context, session *MQTTSession) ([]ComponentOnBus, error) {
+	v, err := m.shared(ctx, "components/"+session.installationID, discoveryTimeout, func(ctx context.Context) (any, error) {
+		return session.GetComponentsOnBus(ctx)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch components on bus: %w", err)
+	}
+	return v.([]ComponentOnBus), nil
+}
+
+func (m *Manager) session(ctx context.Context, installation string) (*MQTTSession, error) {
+	m.m.Lock()
+	if m.shutdown {
+		m.m.Unlock()
+		return nil, ErrShutdown
+	}
+	if session, ok := m.sessions[m.installationIDs[installation]]; ok && session.alive() && !session.expiresSoon() {
+		m.m.Unlock()
+		return session, nil
+	}
+	m.m.Unlock()
+
+	v, err := m.shared(ctx, "session/"+installation, connectTimeout, func(ctx context.Context) (any, error) {
+		return m.connect(ctx, installation)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*MQTTSession), nil
+}
+
+// connect opens a session for the installation, replacing the disconnected or expiring one.
+func (m *Manager) connect(ctx context.Context, installation string) (*MQTTSession, error) {
+	client, err := m.getClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	installations, err := client.Installations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch installations: %w", err)
+	}
+
+	i := slices.IndexFunc(installations, func(ins Installation) bool {
+		return ins.Name == installation || ins.ID == installation
+	})
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInstallationNotFound, installation)
+	}
+	if !installations[i].IsConnected {
+		return nil, fmt.Errorf("%w: installation %s isn't connected to the cloud", ErrDeviceOffline, installation)
+	}
+
+	id := installations[i].ID
+	m.m.Lock()
+	m.installationIDs[installation] = id
+	stale, ok := m.sessions[id]
+	if ok && stale.alive() && !stale.expiresSoon() {
+		m.m.Unlock()
+		return stale, nil
+	}
+	delete(m.sessions, id)
+	m.m.Unlock()
+
+	if ok {
+		slog.Info("MQTT session is disconnected or its credentials expire soon, reconnecting", "installation", installation, "installation_id", id)
+		// Callers may still use the stale session, let their transactions complete.
+		go stale.retire(retireTimeout)
+	}
+
+	session, err := client.MQTT(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("MQTT error: %w", err)
+	}
+
+	err = session.OnParameters(func(componentID string, values Values) {
+		m.state.Update(id, componentID, values)
+	})
+	if err != nil {
+		slog.Warn("Device state won't receive pushed updates", "installation", installation, "installation_id", id, "error", err)
+	}
+
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	if m.shutdown {
+		session.Disconnect()
+		return nil, ErrShutdown
+	}
+	// The installation may have been connected concurrently, when addressed by both its name and ID.
+	if current, ok := m.sessions[id]; ok && current.alive() {
+		session.Disconnect()
+		return current, nil
+	}
+	m.sessions[id] = session
+	return session, nil
+}
+
+func (m *Manager) getClient(ctx context.Context) (*Client, error) {
+	m.m.Lock()
+	client, shutdown := m.client, m.shutdown
+	m.m.Unlock()
+
+	if shutdown {
+		return nil, ErrShutdown
+	}
+	if client != nil {
+		return client, nil
+	}
+
+	v, err := m.shared(ctx, "client", connectTimeout, func(ctx context.Context) (any, error) {
+		client, err := m.newClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create client: %w", err)
+		}
+
+		m.m.Lock()
+		defer m.m.Unlock()
+		m.client = client
+		return client, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*Client), nil
+}
+
+// shared runs f once for concurrent callers with the same key. f is bounded by the timeout
+// but not canceled with the context of the caller, so one caller giving up doesn't fail the others.
+func (m *Manager) shared(ctx context.Context, key string, timeout time.Duration, f func(ctx context.Context) (any, error)) (any, error) {
+	ch := m.calls.DoChan(key, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+		defer cancel()
+		return f(ctx)
+	})
+
+	select {
+	case r := <-ch:
+		return r.Val, r.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close disconnects all MQTT sessions.
+func (m *Manager) Close() {
+	m.m.Lock()
+	sessions := m.sessions
+	m.sessions = map[string]*MQTTSession{}
+	m.m.Unlock()
+
+	for _, session := range sessions {
+		session.Disconnect()
+	}
+}
+
+// Shutdown stops opening sessions, waits for pending transactions of all sessions until
+// the context is done, and disconnects them.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.m.Lock()
+	m.shutdown = true
+	sessions := make([]*MQTTSession, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		sessions = append(sessions, session)
+	}
+	m.m.Unlock()
+
+	var errs []error
+	for _, session := range sessions {
+		if err := session.Drain(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("installation %s: %w", session.installationID, err))
+		}
+	}
+
+	m.Close()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,295 @@
+package econet_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+	"github.com/mtojek/spiroflex-vent-clear/econet/econettest"
+)
+
+// countingDialer counts connections opened through the broker.
+type countingDialer struct {
+	*econettest.Broker
+	dials atomic.Int32
+}
+
+func (d *countingDialer) Dial(ctx context.Context, clientID string, events econet.ConnectionEvents) (econet.PubSub, error) {
+	d.dials.Add(1)
+	return d.Broker.Dial(ctx, clientID, events)
+}
+
+func newTestManager(t *testing.T, broker *econettest.Broker) (*econet.Manager, *countingDialer) {
+	t.Helper()
+
+	dialer := &countingDialer{Broker: broker}
+	m := econet.NewManagerWithTransport(&spiroflex.Config{}, econet.Transport{
+		Credentials: econettest.StaticCredentials(),
+		HTTP: econettest.InstallationsAPI(
+			econet.Installation{ID: "installation-1", Name: "Home", HasAccess: true, IsConnected: true},
+			econet.Installation{ID: "installation-2", Name: "Cottage", HasAccess: true, IsConnected: true},
+		),
+		MQTT: dialer,
+	})
+	t.Cleanup(m.Close)
+	return m, dialer
+}
+
+func componentsOnBus(ops []econet.OperationRequest) []econet.OperationResponse {
+	return []econet.OperationResponse{{
+		Name: econet.GET_COMPONENTS_ON_BUS,
+		Targets: []econet.TargetResponse{{
+			Component:  testComponentID,
+			Parameters: []byte(`{"componentName":"ecoVENT MINI OEM"}`),
+		}},
+	}}
+}
+
+func TestManagerConcurrentConnect(t *testing.T) {
+	broker := econettest.NewBroker()
+	broker.Handle(econettest.Respond(componentsOnBus))
+	m, dialer := newTestManager(t, broker)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, componentID, err := m.Target(testContext(t), "Home", spiroflex.Device{Component: "ecoVENT MINI OEM"})
+			if err != nil {
+				t.Errorf("Target failed: %v", err)
+			} else if componentID != testComponentID {
+				t.Errorf("expected component %s, got %s", testComponentID, componentID)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := dialer.dials.Load(); n != 1 {
+		t.Errorf("expected a single MQTT connection, got %d", n)
+	}
+}
+
+func TestManagerTargetSameNamedComponents(t *testing.T) {
+	broker := econettest.NewBroker()
+	broker.Handle(econettest.Respond(func(ops []econet.OperationRequest) []econet.OperationResponse {
+		return []econet.OperationResponse{{
+			Name: econet.GET_COMPONENTS_ON_BUS,
+			Targets: []econet.TargetResponse{
+				{Component: "component-1", Parameters: []byte(`{"componentName":"ecoVENT MINI OEM"}`)},
+				{Component: "component-2", Parameters: []byte(`{"componentName":"ecoVENT MINI OEM"}`)},
+			},
+		}}
+	}))
+	m, _ := newTestManager(t, broker)
+
+	tests := []struct {
+		name        string
+		device      spiroflex.Device
+		expectedID  string
+		expectedErr error
+	}{
+		{
+			name:        "name only",
+			device:      spiroflex.Device{Name: "Vent", Component: "ecoVENT MINI OEM"},
+			expectedErr: econet.ErrAmbiguousComponent,
+		},
+		{
+			name:       "first ID",
+			device:     spiroflex.Device{Name: "Vent", Component: "ecoVENT MINI OEM", ComponentID: "component-1"},
+			expectedID: "component-1",
+		},
+		{
+			name:       "second ID",
+			device:     spiroflex.Device{Name: "Vent", Component: "ecoVENT MINI OEM", ComponentID: "component-2"},
+			expectedID: "component-2",
+		},
+		{
+			name:        "unknown ID",
+			device:      spiroflex.Device{Name: "Vent", Component: "ecoVENT MINI OEM", ComponentID: "component-3"},
+			expectedErr: econet.ErrComponentNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, componentID, err := m.Target(testContext(t), "Home", tt.device)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("expected %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Target failed: %v", err)
+			}
+			if componentID != tt.expectedID {
+				t.Errorf("expected component %s, got %s", tt.expectedID, componentID)
+			}
+		})
+	}
+}
+
+func TestManagerHungInstallation(t *testing.T) {
+	broker := econettest.NewBroker()
+	respond := econettest.Respond(componentsOnBus)
+	broker.Handle(func(b *econettest.Broker, msg econettest.Message) {
+		// The device of the first installation never responds.
+		if !strings.HasPrefix(msg.Topic, "installation-1/") {
+			respond(b, msg)
+		}
+	})
+	m, _ := newTestManager(t, broker)
+
+	hung, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hungDone := make(chan error, 1)
+	go func() {
+		_, _, err := m.Target(hung, "Home", spiroflex.Device{Component: "ecoVENT MINI OEM"})
+		hungDone <- err
+	}()
+
+	for len(broker.Published()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	_, _, err := m.Target(testContext(t), "Cottage", spiroflex.Device{Component: "ecoVENT MINI OEM"})
+	if err != nil {
+		t.Errorf("Target of the other installation failed: %v", err)
+	}
+
+	cancel()
+	select {
+	case err := <-hungDone:
+		if err == nil {
+			t.Error("expected error of the hung request")
+		}
+	case <-time.After(time.Second):
+		t.Error("hung request doesn't return after its context is canceled")
+	}
+}
+
+func TestManagerReconnectExpiring(t *testing.T) {
+	broker := econettest.NewBroker()
+	respond := econettest.Respond(componentsOnBus)
+	var hold atomic.Bool
+	hold.Store(true)
+	held := make(chan econettest.Message, 1)
+	broker.Handle(func(b *econettest.Broker, msg econettest.Message) {
+		if hold.Load() {
+			held <- msg
+			return
+		}
+		respond(b, msg)
+	})
+	m, _ := newTestManager(t, broker)
+
+	broker.ExpireAt(time.Now().Add(time.Minute))
+	stale, err := m.Session(testContext(t), "Home")
+	if err != nil {
+		t.Fatalf("Session failed: %v", err)
+	}
+
+	pending := make(chan error, 1)
+	go func() {
+		_, err := stale.GetComponentsOnBus(testContext(t))
+		pending <- err
+	}()
+	msg := <-held
+	hold.Store(false)
+
+	broker.ExpireAt(time.Time{})
+	fresh, err := m.Session(testContext(t), "Home")
+	if err != nil {
+		t.Fatalf("Session failed: %v", err)
+	}
+	if fresh == stale {
+		t.Fatal("expected a new session replacing the expiring one")
+	}
+
+	// The stale session rejects new requests, but completes the pending one.
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for {
+		_, err := stale.SendInstallationRequest(canceled, nil)
+		if errors.Is(err, econet.ErrDraining) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	respond(broker, msg)
+	if err := <-pending; err != nil {
+		t.Errorf("pending transaction of the stale session failed: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for stale.IsConnected() {
+		if time.Now().After(deadline) {
+			t.Fatal("stale session isn't disconnected")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestManagerDeviceState(t *testing.T) {
+	broker := econettest.NewBroker()
+	broker.Handle(econettest.Respond(componentsOnBus))
+	m, _ := newTestManager(t, broker)
+
+	// Both installations have a component with the same ID.
+	for installation, level := range map[string]string{"Home": "1", "Cottage": "3"} {
+		session, _, err := m.Target(testContext(t), installation, spiroflex.Device{Component: "ecoVENT MINI OEM"})
+		if err != nil {
+			t.Fatalf("Target failed: %v", err)
+		}
+		topic := session.Diagnostics().InstallationID + "/" + econet.TopicParametersChanged
+		broker.Publish(topic, parametersPayload(t, testComponentID, map[string]string{econet.ParamVentLevel.ID: level}))
+	}
+
+	levels := map[string]string{}
+	for _, s := range m.Diagnostics().Sessions {
+		levels[s.InstallationID] = s.State[testComponentID].Values[econet.ParamVentLevel.ID]
+	}
+	expected := map[string]string{"installation-1": "1", "installation-2": "3"}
+	if !reflect.DeepEqual(levels, expected) {
+		t.Errorf("expected levels %v, got %v", expected, levels)
+	}
+}
+
+func TestManagerKeepsReconnectingSession(t *testing.T) {
+	broker := econettest.NewBroker()
+	m, dialer := newTestManager(t, broker)
+
+	session, err := m.Session(testContext(t), "Home")
+	if err != nil {
+		t.Fatalf("Session failed: %v", err)
+	}
+
+	// paho reconnects on its own, the session is reused meanwhile.
+	broker.Interrupt(errors.New("network is unreachable"))
+	again, err := m.Session(testContext(t), "Home")
+	if err != nil {
+		t.Fatalf("Session failed: %v", err)
+	}
+	if again != session || dialer.dials.Load() != 1 {
+		t.Errorf("expected the reconnecting session to be reused, got %d dials", dialer.dials.Load())
+	}
+
+	// Once the client gives up, a new session is opened.
+	broker.DropConnections(errors.New("connection refused"))
+	fresh, err := m.Session(testContext(t), "Home")
+	if err != nil {
+		t.Fatalf("Session failed: %v", err)
+	}
+	if fresh == session || dialer.dials.Load() != 2 {
+		t.Errorf("expected a new session, got %d dials", dialer.dials.Load())
+	}
+}
@@ -0,0 +1,41 @@
+package econet
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mtojek/spiroflex-vent-clear/metrics"
+)
+
+// operationName labels metrics of the request, e.g. GET_VALUES.
+func operationName(ops []OperationRequest) string {
+	names := make([]string, 0, len(ops))
+	for _, op := range ops {
+		names = append(names, op.Name)
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// recordDeviceValues updates device gauges with the values of known parameters.
+func recordDeviceValues(installationID, componentID string, values Values) {
+	if level, err := values.Decode(ParamVentLevel); err == nil {
+		n, _ := strconv.Atoi(level) // 0 when paused
+		metrics.DeviceLevel.WithLabelValues(installationID, componentID).Set(float64(n))
+	}
+	if mode, err := values.Decode(ParamVentMode); err == nil {
+		metrics.DeviceScheduleMode.WithLabelValues(installationID, componentID).Set(gaugeBool(mode == ParamVentMode.True))
+	}
+	if power, err := values.Decode(ParamVentPower); err == nil {
+		metrics.DevicePower.WithLabelValues(installationID, componentID).Set(gaugeBool(power == ParamVentPower.True))
+	}
+}
+
+func gaugeBool(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -5,32 +5,60 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
-	"net/http"
-	"net/url"
+	"log/slog"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	signer "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
-	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/mtojek/spiroflex-vent-clear/metrics"
+	"github.com/mtojek/spiroflex-vent-clear/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
-	mqttConnectTimeout   = 10 * time.Second
-	mqttSubscribeTimeout = 5 * time.Second
+	mqttConnectTimeout       = 10 * time.Second
+	mqttSubscribeTimeout     = 5 * time.Second
+	mqttPublishTimeout       = 5 * time.Second
+	mqttMaxReconnectInterval = 2 * time.Minute
 )
 
+var (
+	// ErrNotConnected is returned when a request is sent while the MQTT connection is down.
+	ErrNotConnected = errors.New("MQTT client is not connected")
+	// ErrConnectionLost is returned for in-flight requests when the MQTT connection drops.
+	ErrConnectionLost = errors.New("MQTT connection lost")
+	// ErrDraining is returned for requests sent after the session started draining.
+	ErrDraining = errors.New("MQTT session is shutting down")
+
+	errDisconnected = errors.New("session disconnected")
+)
+
+const drainPollInterval = 50 * time.Millisecond
+
+// retireTimeout limits waiting for pending transactions of a session being replaced.
+const retireTimeout = 30 * time.Second
+
 type MQTTSession struct {
 	clientID       string
 	installationID string
 
-	client mqtt.Client
+	client PubSub
 
 	m                  sync.Mutex
-	pending            map[string]chan []byte
+	pending            map[string]chan transactionResult
+	draining           bool
 	transactionCounter atomic.Int64
+
+	hm            sync.Mutex
+	handlers      map[string][]NotificationHandler
+	paramHandlers []ParametersHandler
+
+	history envelopeHistory
+}
+
+type transactionResult struct {
+	payload []byte
+	err     error
 }
 
 type OperationRequest struct {
@@ -68,7 +96,7 @@ type ComponentOnBus struct {
 	DeviceStatus    int    `json:"deviceStatus"`
 	ZDVersion       string `json:"zdVersion"`
 
-	ComponentID string
+	ComponentID string `json:"componentId"`
 }
 
 func (s *MQTTSession) GetComponentsOnBus(ctx context.Context) ([]ComponentOnBus, error) {
@@ -96,86 +124,123 @@ func (s *MQTTSession) GetComponentsOnBus(ctx context.Context) ([]ComponentOnBus,
 	return cobs, nil
 }
 
-func (s *MQTTSession) VentLevel(ctx context.Context, targetComponentID, level string) error {
-	err := s.VentMode(ctx, targetComponentID, PARAM_MODE_MANUAL)
-	if err != nil {
-		return err
-	}
+// Values maps parameter IDs to their raw values.
+type Values map[string]string
 
+func (s *MQTTSession) GetValues(ctx context.Context, componentID string, paramIDs ...string) (Values, error) {
 	resp, err := s.SendInstallationRequest(ctx, []OperationRequest{
 		{
-			Name: PARAMS_MODIFICATION,
+			Name: GET_VALUES,
 			Targets: []TargetRequest{
 				{
-					Component: targetComponentID,
-					Parameters: map[string]string{
-						PARAM_POWER_LEVEL_ID: level,
-					},
+					Component:  componentID,
+					Parameters: paramIDs,
 				},
 			},
 		},
 	})
 	if err != nil {
-		return fmt.Errorf("SendInstallationRequest failed: %w", err)
+		return nil, fmt.Errorf("SendInstallationRequest failed: %w", err)
+	}
+
+	for _, op := range resp {
+		for _, t := range op.Targets {
+			if t.Component != componentID {
+				continue
+			}
+
+			if t.StatusCode != 0 {
+				return nil, &StatusError{Operation: "get values", StatusCode: t.StatusCode}
+			}
+
+			values, err := decodeValues(t.Parameters)
+			if err != nil {
+				return nil, err
+			}
+			recordDeviceValues(s.installationID, componentID, values)
+			s.notifyParameters(componentID, values)
+			return values, nil
+		}
 	}
-	return verifyParamsModificationStatus(targetComponentID, resp)
+	return nil, ErrComponentNotFound
 }
 
-func (s *MQTTSession) VentPause(ctx context.Context, targetComponentID string) error {
-	err := s.VentMode(ctx, targetComponentID, PARAM_MODE_MANUAL)
+func decodeValues(parameters json.RawMessage) (Values, error) {
+	var raw map[string]json.RawMessage
+	err := json.Unmarshal(parameters, &raw)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("can't unmarshal Parameters struct: %w", err)
 	}
 
-	resp, err := s.SendInstallationRequest(ctx, []OperationRequest{
-		{
-			Name: PARAMS_MODIFICATION,
-			Targets: []TargetRequest{
-				{
-					Component: targetComponentID,
-					Parameters: map[string]string{
-						PARAM_POWER_LEVEL_ID: PARAM_POWER_LEVEL_PAUSE,
-					},
-				},
-			},
-		},
-	})
+	values := Values{}
+	for id, v := range raw {
+		var str string
+		if json.Unmarshal(v, &str) == nil {
+			values[id] = str
+		} else {
+			values[id] = string(v)
+		}
+	}
+	return values, nil
+}
+
+// Decode returns the human-readable value of the parameter.
+func (v Values) Decode(p Param) (string, error) {
+	raw, ok := v[p.ID]
+	if !ok {
+		return "", fmt.Errorf("missing value of parameter %s", p.Name)
+	}
+	return p.Decode(raw)
+}
+
+// Describe returns the human-readable value of the parameter, or the raw one marked as unknown
+// if it can't be decoded.
+func (v Values) Describe(p Param) string {
+	decoded, err := v.Decode(p)
 	if err != nil {
-		return fmt.Errorf("SendInstallationRequest failed: %w", err)
+		return "unknown (" + v[p.ID] + ")"
 	}
-	return verifyParamsModificationStatus(targetComponentID, resp)
+	return decoded
 }
 
-func (s *MQTTSession) VentMode(ctx context.Context, targetComponentID, mode string) error {
-	resp, err := s.SendInstallationRequest(ctx, []OperationRequest{
-		{
-			Name: PARAMS_MODIFICATION,
-			Targets: []TargetRequest{
-				{
-					Component: targetComponentID,
-					Parameters: map[string]string{
-						PARAM_MODE_ID: mode,
-					},
-				},
-			},
-		},
-	})
+func (s *MQTTSession) VentLevel(ctx context.Context, targetComponentID, level string) error {
+	err := s.VentMode(ctx, targetComponentID, ParamVentMode.False)
 	if err != nil {
-		return fmt.Errorf("SendInstallationRequest failed: %w", err)
+		return err
 	}
-	return verifyParamsModificationStatus(targetComponentID, resp)
+	return s.SetValue(ctx, targetComponentID, ParamVentLevel, level)
+}
+
+func (s *MQTTSession) VentPause(ctx context.Context, targetComponentID string) error {
+	return s.VentLevel(ctx, targetComponentID, "pause")
+}
+
+func (s *MQTTSession) VentMode(ctx context.Context, targetComponentID, mode string) error {
+	return s.SetValue(ctx, targetComponentID, ParamVentMode, mode)
 }
 
 func (s *MQTTSession) VentPower(ctx context.Context, targetComponentID, power string) error {
+	return s.SetValue(ctx, targetComponentID, ParamVentPower, power)
+}
+
+// SetValue encodes the human-readable value and modifies the parameter.
+func (s *MQTTSession) SetValue(ctx context.Context, targetComponentID string, p Param, value string) error {
+	encoded, err := p.Encode(value)
+	if err != nil {
+		return err
+	}
+	return s.SetValues(ctx, targetComponentID, Values{p.ID: encoded})
+}
+
+// SetValues modifies parameters to the raw values.
+func (s *MQTTSession) SetValues(ctx context.Context, targetComponentID string, values Values) error {
 	resp, err := s.SendInstallationRequest(ctx, []OperationRequest{
 		{
 			Name: PARAMS_MODIFICATION,
 			Targets: []TargetRequest{
 				{
-					Component: targetComponentID,
-					Parameters: map[string]string{
-						PARAM_POWER_ID: power,
-					},
+					Component:  targetComponentID,
+					Parameters: values,
 				},
 			},
 		},
@@ -183,7 +248,13 @@ func (s *MQTTSession) VentPower(ctx context.Context, targetComponentID, power st
 	if err != nil {
 		return fmt.Errorf("SendInstallationRequest failed: %w", err)
 	}
-	return verifyParamsModificationStatus(targetComponentID, resp)
+
+	err = verifyParamsModificationStatus(targetComponentID, resp)
+	if err != nil {
+		return err
+	}
+	s.notifyParameters(targetComponentID, values)
+	return nil
 }
 
 func verifyParamsModificationStatus(targetComponentID string, resp []OperationResponse) error {
@@ -194,22 +265,31 @@ func verifyParamsModificationStatus(targetComponentID string, resp []OperationRe
 			}
 
 			if t.StatusCode != 0 {
-				return fmt.Errorf("params modification failed, status code: %w", t.StatusCode)
+				return &StatusError{Operation: "params modification", StatusCode: t.StatusCode}
 			}
 			return nil
 		}
 	}
-	return fmt.Errorf("component not found")
+	return ErrComponentNotFound
 }
 
-func (s *MQTTSession) SendInstallationRequest(ctx context.Context, ops []OperationRequest) ([]OperationResponse, error) {
+func (s *MQTTSession) SendInstallationRequest(ctx context.Context, ops []OperationRequest) (resp []OperationResponse, err error) {
+	ctx, span := tracer.Start(ctx, "econet.SendInstallationRequest", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrInstallationID.String(s.installationID), attrClientID.String(s.clientID), attrOperation.String(operationName(ops))))
+	defer func() { tracing.End(span, err) }()
+
 	type envelopeRequest struct {
 		TransactionID string             `json:"transactionId"`
 		Operations    []OperationRequest `json:"operations,omitempty"`
 	}
 
+	if !s.IsConnected() {
+		return nil, ErrNotConnected
+	}
+
 	c := s.transactionCounter.Add(1)
 	transactionID := fmt.Sprintf("%d", c)
+	span.SetAttributes(attrTransactionID.String(transactionID))
 
 	msg, err := json.Marshal(&envelopeRequest{
 		TransactionID: transactionID,
@@ -219,29 +299,40 @@ func (s *MQTTSession) SendInstallationRequest(ctx context.Context, ops []Operati
 		return nil, fmt.Errorf("can't marshal message envelope: %w", err)
 	}
 
-	respCh := make(chan []byte, 1)
+	respCh := make(chan transactionResult, 1)
 
 	s.m.Lock()
+	if s.draining {
+		s.m.Unlock()
+		return nil, ErrDraining
+	}
 	s.pending[transactionID] = respCh
 	s.m.Unlock()
 
+	pending := metrics.MQTTPendingTransactions.WithLabelValues(s.installationID)
+	pending.Inc()
+
+	start, result := time.Now(), "error"
 	defer func() {
 		s.m.Lock()
 		delete(s.pending, transactionID)
 		close(respCh)
 		s.m.Unlock()
+
+		pending.Dec()
+		metrics.MQTTRequestDuration.WithLabelValues(operationName(ops), result).Observe(time.Since(start).Seconds())
 	}()
 
 	topic := fmt.Sprintf("%s/%s/installationRequest", s.installationID, s.clientID)
-	log.Printf("Publish message on %s: %s", topic, string(msg))
+	s.logger().Debug("Publish installation request", "topic", topic, "transaction_id", transactionID, "operation", operationName(ops), "payload", string(msg))
 
-	token := s.client.Publish(topic, 1, false, msg)
-	if !token.WaitTimeout(5 * time.Second) {
-		return nil, errors.New("publish timeout")
-	}
-	if err := token.Error(); err != nil {
-		return nil, fmt.Errorf("publish error: %w", err)
+	// Recorded before publishing, so the response can't precede it.
+	s.history.add(DirectionRequest, topic, transactionID, msg)
+	err = s.client.Publish(topic, msg)
+	if err != nil {
+		return nil, err
 	}
+	span.AddEvent("published")
 
 	type envelopeResponse struct {
 		TransactionID string              `json:"transactionId"`
@@ -250,75 +341,116 @@ func (s *MQTTSession) SendInstallationRequest(ctx context.Context, ops []Operati
 
 	select {
 	case resp := <-respCh:
+		if resp.err != nil {
+			return nil, fmt.Errorf("transaction ID: %s, error: %w", transactionID, resp.err)
+		}
 
 		var e envelopeResponse
-		err := json.Unmarshal(resp, &e)
+		err := json.Unmarshal(resp.payload, &e)
 		if err != nil {
-			return nil, fmt.Errorf("unable to unmarshal message, transaction ID: %s, error: %w", transactionID, ctx.Err())
+			return nil, fmt.Errorf("unable to unmarshal message, transaction ID: %s, error: %w", transactionID, err)
 		}
+		result = "ok"
 		return e.Operations, nil
 	case <-ctx.Done():
-		return nil, fmt.Errorf("timeout waiting for response, transaction ID: %s, error: %w", transactionID, ctx.Err())
+		// Canceled requests, e.g. when the client went away, aren't device timeouts.
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("transaction ID: %s, error: %w", transactionID, ctx.Err())
+		}
+		result = "timeout"
+		return nil, fmt.Errorf("%w, transaction ID: %s, error: %w", ErrTimeout, transactionID, ctx.Err())
 	}
 }
 
-func (s *MQTTSession) Disconnect() {
-	s.client.Disconnect(100)
+// IsConnected reports whether the connection to the MQTT broker is currently open.
+func (s *MQTTSession) IsConnected() bool {
+	return s.client.IsConnectionOpen()
 }
 
-func (c *Client) MQTT(ctx context.Context, installationID string) (*MQTTSession, error) {
-	now := time.Now()
+// alive reports whether the connection is open or being reestablished.
+func (s *MQTTSession) alive() bool {
+	return s.client.IsConnected()
+}
 
-	s := signer.NewSigner()
-	awsCreds := aws.Credentials{
-		AccessKeyID:     *c.creds.AccessKeyId,
-		SecretAccessKey: *c.creds.SecretKey,
-		Source:          "CognitoIdentity",
-	}
+// expiresSoon reports whether the credentials used to open the connection are about to expire.
+func (s *MQTTSession) expiresSoon() bool {
+	expiresAt := s.client.ExpiresAt()
+	return !expiresAt.IsZero() && expiresSoon(expiresAt)
+}
 
-	mqttURL := fmt.Sprintf("wss://%s.iot.%s.amazonaws.com/mqtt", c.cfg.IoT.Name, c.cfg.Region)
-	req, err := http.NewRequest("GET", mqttURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("can't build HTTP request: %w", err)
-	}
+// Drain rejects new requests and waits until pending transactions are completed.
+func (s *MQTTSession) Drain(ctx context.Context) error {
+	s.m.Lock()
+	s.draining = true
+	s.m.Unlock()
 
-	signedURL, _, err := s.PresignHTTP(ctx, awsCreds, req, payloadHash, "iotdevicegateway", c.cfg.Region, now)
-	if err != nil {
-		return nil, fmt.Errorf("unable to presign MQTT URL: %w", err)
-	}
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.m.Lock()
+		pending := len(s.pending)
+		s.m.Unlock()
+		if pending == 0 {
+			return nil
+		}
 
-	if c.creds.SessionToken != nil {
-		signedURL += "&X-Amz-Security-Token=" + url.QueryEscape(*c.creds.SessionToken)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d transaction(s) still pending: %w", pending, ctx.Err())
+		case <-ticker.C:
+		}
 	}
+}
 
-	clientID := fmt.Sprintf("%s-%d", c.identityID, now.UnixMilli())
-	opts := mqtt.NewClientOptions().
-		AddBroker(signedURL).
-		SetClientID(clientID).
-		SetProtocolVersion(3)
+// Disconnect closes the connection and fails pending transactions, as the client doesn't
+// report a deliberate disconnect as a lost connection.
+func (s *MQTTSession) Disconnect() {
+	s.client.Disconnect()
+	s.failPending(errDisconnected)
+}
 
-	client := mqtt.NewClient(opts)
-	token := client.Connect()
-	if !token.WaitTimeout(mqttConnectTimeout) {
-		return nil, errors.New("connection to MQTT broker timed out")
-	}
-	if token.Error() != nil {
-		return nil, fmt.Errorf("unable to connect to MQTT broker: %w", token.Error())
+// retire rejects new requests, waits for pending transactions until the timeout
+// and disconnects the session.
+func (s *MQTTSession) retire(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := s.Drain(ctx); err != nil {
+		s.logger().Warn("MQTT session is disconnected with pending transactions", "error", err)
 	}
-	log.Printf("MQTT client connected, installationID: %s, clientID: %s", installationID, clientID)
+	s.Disconnect()
+}
+
+func (c *Client) MQTT(ctx context.Context, installationID string) (_ *MQTTSession, err error) {
+	clientID := fmt.Sprintf("%s-%d", c.creds.IdentityID(), time.Now().UnixMilli())
+	ctx, span := tracer.Start(ctx, "econet.MQTT", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrInstallationID.String(installationID), attrClientID.String(clientID)))
+	defer func() { tracing.End(span, err) }()
 
 	session := &MQTTSession{
 		clientID:       clientID,
 		installationID: installationID,
 
-		client: client,
+		pending:  map[string]chan transactionResult{},
+		handlers: map[string][]NotificationHandler{},
+	}
 
-		pending: map[string]chan []byte{},
+	client, err := c.dialer.Dial(ctx, clientID, ConnectionEvents{
+		OnReconnect:      session.onReconnect,
+		OnConnectionLost: session.onConnectionLost,
+	})
+	if err != nil {
+		return nil, err
 	}
+	session.client = client
+	metrics.MQTTConnects.Inc()
+	session.logger().Info("MQTT client connected")
+
 	err = session.startReceiving()
 	if err != nil {
-		log.Println("MQTT client will disconnect due to error")
-		client.Disconnect(0)
+		session.logger().Error("MQTT client will disconnect due to error", "error", err)
+		client.Disconnect()
 
 		return nil, fmt.Errorf("unable to start receiving: %w", err)
 	}
@@ -326,9 +458,9 @@ func (c *Client) MQTT(ctx context.Context, installationID string) (*MQTTSession,
 }
 
 func (s *MQTTSession) startReceiving() error {
-	irTopic := fmt.Sprintf("%s/%s/installationResponse", s.installationID, s.clientID)
+	irTopic := s.responseTopic()
 
-	log.Printf("Start receiving messages on %s", irTopic)
+	s.logger().Debug("Start receiving messages", "topic", irTopic)
 	err := s.subscribe(irTopic, s.onTransactionalMessage)
 	if err != nil {
 		return fmt.Errorf("unable to subscribe to installationResponse: %w", err)
@@ -336,26 +468,75 @@ func (s *MQTTSession) startReceiving() error {
 	return nil
 }
 
-func (s *MQTTSession) subscribe(topic string, handler mqtt.MessageHandler) error {
-	t := s.client.Subscribe(topic, 1, handler)
-	t.WaitTimeout(mqttSubscribeTimeout)
-	return t.Error()
+func (s *MQTTSession) responseTopic() string {
+	return fmt.Sprintf("%s/%s/installationResponse", s.installationID, s.clientID)
 }
 
-func (s *MQTTSession) onTransactionalMessage(client mqtt.Client, msg mqtt.Message) {
-	log.Printf("Message received on %s: %s", msg.Topic(), string(msg.Payload()))
+func (s *MQTTSession) onReconnect() {
+	metrics.MQTTReconnects.Inc()
+	s.logger().Info("MQTT client reconnected")
+	err := s.startReceiving()
+	if err != nil {
+		s.logger().Error("MQTT client can't resubscribe", "error", err)
+	}
+
+	s.hm.Lock()
+	var topics []string
+	for topic := range s.handlers {
+		topics = append(topics, topic)
+	}
+	s.hm.Unlock()
+
+	for _, topic := range topics {
+		err := s.subscribe(topic, s.onNotification)
+		if err != nil {
+			s.logger().Error("MQTT client can't resubscribe", "topic", topic, "error", err)
+		}
+	}
+}
+
+func (s *MQTTSession) onConnectionLost(err error) {
+	metrics.MQTTConnectionLosses.Inc()
+	s.logger().Warn("MQTT connection lost", "error", err)
+	s.failPending(err)
+}
+
+// failPending fails pending transactions with ErrConnectionLost caused by err.
+func (s *MQTTSession) failPending(err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for transactionID, ch := range s.pending {
+		select {
+		case ch <- transactionResult{err: fmt.Errorf("%w: %v", ErrConnectionLost, err)}:
+		default:
+			s.logger().Warn("Transaction already has a result", "transaction_id", transactionID)
+		}
+	}
+}
+
+func (s *MQTTSession) logger() *slog.Logger {
+	return slog.With("installation_id", s.installationID, "client_id", s.clientID)
+}
+
+func (s *MQTTSession) subscribe(topic string, handler func(topic string, payload []byte)) error {
+	return s.client.Subscribe(topic, handler)
+}
 
+func (s *MQTTSession) onTransactionalMessage(topic string, payload []byte) {
 	var envelope struct {
 		TransactionID string `json:"transactionId"`
 	}
 
-	err := json.Unmarshal(msg.Payload(), &envelope)
+	err := json.Unmarshal(payload, &envelope)
 	if err != nil {
-		log.Printf("Message will be ignored due to error: %w", err)
+		s.logger().Warn("Message will be ignored", "topic", topic, "payload", string(payload), "error", err)
 		return
 	}
+	s.logger().Debug("Message received", "topic", topic, "transaction_id", envelope.TransactionID, "payload", string(payload))
+	s.history.add(DirectionResponse, topic, envelope.TransactionID, payload)
 	if envelope.TransactionID == "" {
-		log.Printf("Message will be ignored due to missing transaction ID")
+		s.dispatch(topic, payload)
 		return
 	}
 
@@ -365,11 +546,12 @@ func (s *MQTTSession) onTransactionalMessage(client mqtt.Client, msg mqtt.Messag
 
 	if ok {
 		select {
-		case ch <- msg.Payload():
+		case ch <- transactionResult{payload: payload}:
 		default:
-			log.Printf("full channel for transaction ID: %s", envelope.TransactionID)
+			s.logger().Warn("Transaction already has a result", "transaction_id", envelope.TransactionID)
 		}
 	} else {
-		log.Printf("unexpected messaged received, transaction ID: %s", envelope.TransactionID)
+		s.logger().Warn("Unexpected message received", "transaction_id", envelope.TransactionID)
+		s.dispatch(topic, payload)
 	}
 }
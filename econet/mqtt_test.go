@@ -0,0 +1,509 @@
+package econet_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+	"github.com/mtojek/spiroflex-vent-clear/econet/econettest"
+)
+
+const (
+	testInstallationID = "installation-1"
+	testComponentID    = "component-1"
+)
+
+func newTestSession(t *testing.T, broker *econettest.Broker) *econet.MQTTSession {
+	t.Helper()
+
+	client := econet.NewWithTransport(&spiroflex.Config{}, econet.Transport{
+		Credentials: econettest.StaticCredentials(),
+		HTTP:        econettest.InstallationsAPI(),
+		MQTT:        broker,
+	})
+
+	session, err := client.MQTT(context.Background(), testInstallationID)
+	if err != nil {
+		t.Fatalf("MQTT failed: %v", err)
+	}
+	t.Cleanup(session.Disconnect)
+	return session
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func rawJSON(t *testing.T, v any) json.RawMessage {
+	t.Helper()
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %v", err)
+	}
+	return b
+}
+
+func TestGetComponentsOnBus(t *testing.T) {
+	tests := []struct {
+		name     string
+		targets  []econet.TargetResponse
+		expected []econet.ComponentOnBus
+		wantErr  bool
+	}{
+		{
+			name:    "no components",
+			targets: nil,
+		},
+		{
+			name: "two components",
+			targets: []econet.TargetResponse{
+				{
+					Component:  "c1",
+					Parameters: rawJSON(t, map[string]any{"componentName": "ecoVENT MINI OEM", "deviceStatus": 1}),
+				},
+				{
+					Component:  "c2",
+					Parameters: rawJSON(t, map[string]any{"componentName": "ecoNET300", "zdVersion": "1.2"}),
+				},
+			},
+			expected: []econet.ComponentOnBus{
+				{ComponentName: "ecoVENT MINI OEM", DeviceStatus: 1, ComponentID: "c1"},
+				{ComponentName: "ecoNET300", ZDVersion: "1.2", ComponentID: "c2"},
+			},
+		},
+		{
+			name: "malformed parameters",
+			targets: []econet.TargetResponse{
+				{Component: "c1", Parameters: json.RawMessage(`"text"`)},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := econettest.NewBroker()
+			broker.Handle(econettest.Respond(func(ops []econet.OperationRequest) []econet.OperationResponse {
+				return []econet.OperationResponse{{Name: econet.GET_COMPONENTS_ON_BUS, Targets: tt.targets}}
+			}))
+			session := newTestSession(t, broker)
+
+			cobs, err := session.GetComponentsOnBus(testContext(t))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetComponentsOnBus failed: %v", err)
+			}
+			if !reflect.DeepEqual(cobs, tt.expected) {
+				t.Errorf("expected %+v, got %+v", tt.expected, cobs)
+			}
+		})
+	}
+}
+
+func TestVentLevel(t *testing.T) {
+	tests := []struct {
+		name       string
+		level      string
+		statusCode int
+		expected   []map[string]string
+		wantErr    bool
+	}{
+		{
+			name:  "level 1",
+			level: "1",
+			expected: []map[string]string{
+				{econet.ParamVentMode.ID: "H0L1"},
+				{econet.ParamVentLevel.ID: "3"},
+			},
+		},
+		{
+			name:  "level 3",
+			level: "3",
+			expected: []map[string]string{
+				{econet.ParamVentMode.ID: "H0L1"},
+				{econet.ParamVentLevel.ID: "5"},
+			},
+		},
+		{
+			name:    "invalid level",
+			level:   "4",
+			wantErr: true,
+			expected: []map[string]string{
+				{econet.ParamVentMode.ID: "H0L1"},
+			},
+		},
+		{
+			name:       "rejected by device",
+			level:      "2",
+			statusCode: 7,
+			wantErr:    true,
+			expected: []map[string]string{
+				{econet.ParamVentMode.ID: "H0L1"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m sync.Mutex
+			var modifications []map[string]string
+
+			broker := econettest.NewBroker()
+			broker.Handle(econettest.Respond(func(ops []econet.OperationRequest) []econet.OperationResponse {
+				var resp []econet.OperationResponse
+				for _, op := range ops {
+					r := econet.OperationResponse{Name: op.Name}
+					for _, target := range op.Targets {
+						params := map[string]string{}
+						b, _ := json.Marshal(target.Parameters)
+						json.Unmarshal(b, &params)
+
+						m.Lock()
+						modifications = append(modifications, params)
+						m.Unlock()
+
+						r.Targets = append(r.Targets, econet.TargetResponse{Component: target.Component, StatusCode: tt.statusCode})
+					}
+					resp = append(resp, r)
+				}
+				return resp
+			}))
+			session := newTestSession(t, broker)
+
+			err := session.VentLevel(testContext(t), testComponentID, tt.level)
+			if tt.wantErr && err == nil {
+				t.Fatal("expected error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("VentLevel failed: %v", err)
+			}
+
+			m.Lock()
+			defer m.Unlock()
+			if !reflect.DeepEqual(modifications, tt.expected) {
+				t.Errorf("expected modifications %v, got %v", tt.expected, modifications)
+			}
+		})
+	}
+}
+
+func TestVerifyParamsModificationStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		resp    []econet.OperationResponse
+		wantErr error
+	}{
+		{
+			name: "success",
+			resp: []econet.OperationResponse{
+				{Targets: []econet.TargetResponse{{Component: testComponentID}}},
+			},
+		},
+		{
+			name: "success among other components",
+			resp: []econet.OperationResponse{
+				{Targets: []econet.TargetResponse{{Component: "other", StatusCode: 3}}},
+				{Targets: []econet.TargetResponse{{Component: testComponentID}}},
+			},
+		},
+		{
+			name: "non-zero status code",
+			resp: []econet.OperationResponse{
+				{Targets: []econet.TargetResponse{{Component: testComponentID, StatusCode: 1}}},
+			},
+			wantErr: &econet.StatusError{Operation: "params modification", StatusCode: 1},
+		},
+		{
+			name: "component missing",
+			resp: []econet.OperationResponse{
+				{Targets: []econet.TargetResponse{{Component: "other"}}},
+			},
+			wantErr: econet.ErrComponentNotFound,
+		},
+		{
+			name:    "empty response",
+			wantErr: econet.ErrComponentNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := econet.VerifyParamsModificationStatus(testComponentID, tt.resp)
+			if !reflect.DeepEqual(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestTransactionCorrelation(t *testing.T) {
+	const requests = 5
+
+	var m sync.Mutex
+	var received []econettest.Message
+	allReceived := make(chan struct{})
+
+	broker := econettest.NewBroker()
+	broker.Handle(func(b *econettest.Broker, msg econettest.Message) {
+		m.Lock()
+		defer m.Unlock()
+
+		received = append(received, msg)
+		if len(received) == requests {
+			close(allReceived)
+		}
+	})
+	session := newTestSession(t, broker)
+	ctx := testContext(t)
+
+	var wg sync.WaitGroup
+	results := make([]string, requests)
+	for i := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			resp, err := session.SendInstallationRequest(ctx, []econet.OperationRequest{{Name: fmt.Sprintf("op-%d", i)}})
+			if err != nil {
+				t.Errorf("SendInstallationRequest failed: %v", err)
+				return
+			}
+			results[i] = resp[0].Name
+		}()
+	}
+
+	select {
+	case <-allReceived:
+	case <-ctx.Done():
+		t.Fatal("requests not received")
+	}
+
+	topic := strings.TrimSuffix(received[0].Topic, "installationRequest") + "installationResponse"
+
+	// Unknown transactions and malformed messages must not disturb pending ones.
+	session.OnTransactionalMessage(topic, []byte(`{"transactionId":"unknown","operations":[{"name":"unknown"}]}`))
+	session.OnTransactionalMessage(topic, []byte(`not JSON`))
+
+	// Respond in reverse order, each request must receive its own response.
+	for i := len(received) - 1; i >= 0; i-- {
+		var req struct {
+			TransactionID string                    `json:"transactionId"`
+			Operations    []econet.OperationRequest `json:"operations"`
+		}
+		if err := json.Unmarshal(received[i].Payload, &req); err != nil {
+			t.Fatalf("invalid request: %v", err)
+		}
+
+		resp := fmt.Sprintf(`{"transactionId":%q,"operations":[{"name":%q}]}`, req.TransactionID, req.Operations[0].Name)
+		session.OnTransactionalMessage(topic, []byte(resp))
+	}
+	wg.Wait()
+
+	for i, name := range results {
+		if expected := fmt.Sprintf("op-%d", i); name != expected {
+			t.Errorf("request %d: expected response %s, got %s", i, expected, name)
+		}
+	}
+}
+
+func TestSendInstallationRequestConnectionLost(t *testing.T) {
+	broker := econettest.NewBroker()
+	session := newTestSession(t, broker)
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := session.SendInstallationRequest(testContext(t), []econet.OperationRequest{{Name: econet.GET_COMPONENTS_ON_BUS}})
+		errCh <- err
+	}()
+
+	for len(broker.Published()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	broker.DropConnections(errors.New("network is down"))
+
+	if err := <-errCh; !errors.Is(err, econet.ErrConnectionLost) {
+		t.Errorf("expected ErrConnectionLost, got %v", err)
+	}
+
+	_, err := session.SendInstallationRequest(testContext(t), nil)
+	if !errors.Is(err, econet.ErrNotConnected) {
+		t.Errorf("expected ErrNotConnected, got %v", err)
+	}
+}
+
+func TestDisconnectFailsPending(t *testing.T) {
+	broker := econettest.NewBroker()
+	session := newTestSession(t, broker)
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := session.SendInstallationRequest(testContext(t), []econet.OperationRequest{{Name: econet.GET_COMPONENTS_ON_BUS}})
+		errCh <- err
+	}()
+
+	for len(broker.Published()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	session.Disconnect()
+
+	if err := <-errCh; !errors.Is(err, econet.ErrConnectionLost) {
+		t.Errorf("expected ErrConnectionLost, got %v", err)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	broker := econettest.NewBroker()
+	session := newTestSession(t, broker)
+	ctx := testContext(t)
+
+	respCh := make(chan error, 1)
+	go func() {
+		_, err := session.SendInstallationRequest(ctx, []econet.OperationRequest{{Name: econet.GET_COMPONENTS_ON_BUS}})
+		respCh <- err
+	}()
+
+	for len(broker.Published()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	drainCh := make(chan error, 1)
+	go func() {
+		drainCh <- session.Drain(ctx)
+	}()
+
+	// Wait until the session is draining, new requests must be rejected. Probes are sent
+	// with a canceled context, so they don't remain pending themselves.
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	for {
+		_, err := session.SendInstallationRequest(canceled, nil)
+		if errors.Is(err, econet.ErrDraining) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case err := <-drainCh:
+		t.Fatalf("Drain returned with a pending transaction: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	msg := broker.Published()[0]
+	var req struct {
+		TransactionID string `json:"transactionId"`
+	}
+	if err := json.Unmarshal(msg.Payload, &req); err != nil {
+		t.Fatalf("invalid request: %v", err)
+	}
+	topic := strings.TrimSuffix(msg.Topic, "installationRequest") + "installationResponse"
+	session.OnTransactionalMessage(topic, []byte(fmt.Sprintf(`{"transactionId":%q,"operations":[]}`, req.TransactionID)))
+
+	if err := <-respCh; err != nil {
+		t.Errorf("pending transaction failed: %v", err)
+	}
+	if err := <-drainCh; err != nil {
+		t.Errorf("Drain failed: %v", err)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	broker := econettest.NewBroker()
+	session := newTestSession(t, broker)
+
+	go session.SendInstallationRequest(testContext(t), []econet.OperationRequest{{Name: econet.GET_COMPONENTS_ON_BUS}})
+	for len(broker.Published()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := session.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestRequestCanceledOrTimedOut(t *testing.T) {
+	// The broker never responds.
+	session := newTestSession(t, econettest.NewBroker())
+	ops := []econet.OperationRequest{{Name: econet.GET_COMPONENTS_ON_BUS}}
+
+	timeout, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := session.SendInstallationRequest(timeout, ops); !errors.Is(err, econet.ErrTimeout) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	_, err := session.SendInstallationRequest(canceled, ops)
+	if !errors.Is(err, context.Canceled) || errors.Is(err, econet.ErrTimeout) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestReconnectResubscribes(t *testing.T) {
+	broker := econettest.NewBroker()
+	session := newTestSession(t, broker)
+
+	parameters := make(chan econet.Values, 1)
+	err := session.OnParameters(func(componentID string, values econet.Values) { parameters <- values })
+	if err != nil {
+		t.Fatalf("OnParameters failed: %v", err)
+	}
+	responseTopic := testInstallationID + "/" + session.Diagnostics().ClientID + "/installationResponse"
+	parametersTopic := testInstallationID + "/" + econet.TopicParametersChanged
+	expected := []string{responseTopic, parametersTopic}
+
+	broker.Interrupt(errors.New("network is unreachable"))
+	if session.IsConnected() {
+		t.Error("expected the connection to be closed while reconnecting")
+	}
+	if _, err := session.SendInstallationRequest(testContext(t), nil); !errors.Is(err, econet.ErrNotConnected) {
+		t.Errorf("expected ErrNotConnected while reconnecting, got %v", err)
+	}
+	if topics := broker.Subscriptions(); len(topics) != 0 {
+		t.Errorf("expected no subscriptions while reconnecting, got %v", topics)
+	}
+
+	broker.Reconnect()
+	if topics := broker.Subscriptions(); !reflect.DeepEqual(topics, expected) {
+		t.Errorf("expected subscriptions %v after reconnect, got %v", expected, topics)
+	}
+
+	broker.Handle(econettest.Respond(func(ops []econet.OperationRequest) []econet.OperationResponse {
+		return []econet.OperationResponse{{
+			Name:    econet.GET_COMPONENTS_ON_BUS,
+			Targets: []econet.TargetResponse{{Component: testComponentID, Parameters: []byte(`{"componentName":"ecoVENT MINI OEM"}`)}},
+		}}
+	}))
+	if _, err := session.GetComponentsOnBus(testContext(t)); err != nil {
+		t.Errorf("request after reconnect failed: %v", err)
+	}
+
+	broker.Publish(parametersTopic, parametersPayload(t, testComponentID, map[string]string{"u81": "2"}))
+	select {
+	case values := <-parameters:
+		if values["u81"] != "2" {
+			t.Errorf("unexpected values: %v", values)
+		}
+	default:
+		t.Error("notification isn't delivered after reconnect")
+	}
+}
@@ -0,0 +1,125 @@
+package econet
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Topic suffixes of installation-level notifications pushed by the broker. They haven't been
+// confirmed by captured traffic, parameter values are also taken from responses to requests.
+const (
+	TopicInstallationChanged = "installationChanged"
+	TopicParametersChanged   = "parametersChanged"
+)
+
+// Notification is an unsolicited message pushed by the broker.
+type Notification struct {
+	Topic      string
+	Operations []OperationResponse
+	Payload    json.RawMessage
+}
+
+type NotificationHandler func(n Notification)
+
+// ParametersHandler is called with parameter values reported for the component.
+type ParametersHandler func(componentID string, values Values)
+
+// Subscribe registers the handler for notifications published on the installation topic
+// with the given suffix.
+func (s *MQTTSession) Subscribe(topicSuffix string, handler NotificationHandler) error {
+	topic := fmt.Sprintf("%s/%s", s.installationID, topicSuffix)
+
+	s.hm.Lock()
+	_, subscribed := s.handlers[topic]
+	s.handlers[topic] = append(s.handlers[topic], handler)
+	s.hm.Unlock()
+
+	if subscribed {
+		return nil
+	}
+
+	s.logger().Debug("Start receiving notifications", "topic", topic)
+	err := s.subscribe(topic, s.onNotification)
+	if err != nil {
+		s.hm.Lock()
+		delete(s.handlers, topic)
+		s.hm.Unlock()
+		return fmt.Errorf("unable to subscribe to %s: %w", topicSuffix, err)
+	}
+	return nil
+}
+
+// OnInstallationChange registers the handler for installation-level change notifications.
+func (s *MQTTSession) OnInstallationChange(handler NotificationHandler) error {
+	return s.Subscribe(TopicInstallationChanged, handler)
+}
+
+// OnParameters registers the handler for parameter values pushed by the broker, reported
+// in unsolicited responses, read with GetValues or successfully modified.
+func (s *MQTTSession) OnParameters(handler ParametersHandler) error {
+	s.hm.Lock()
+	s.paramHandlers = append(s.paramHandlers, handler)
+	s.hm.Unlock()
+
+	return s.Subscribe(TopicParametersChanged, func(n Notification) {})
+}
+
+func (s *MQTTSession) onNotification(topic string, payload []byte) {
+	s.logger().Debug("Notification received", "topic", topic, "payload", string(payload))
+	s.dispatch(topic, payload)
+}
+
+func (s *MQTTSession) dispatch(topic string, payload []byte) {
+	var envelope struct {
+		Operations []OperationResponse `json:"operations,omitempty"`
+	}
+
+	err := json.Unmarshal(payload, &envelope)
+	if err != nil {
+		s.logger().Warn("Notification will be ignored", "topic", topic, "error", err)
+		return
+	}
+
+	n := Notification{
+		Topic:      topic,
+		Operations: envelope.Operations,
+		Payload:    payload,
+	}
+
+	s.hm.Lock()
+	handlers := s.handlers[topic]
+	s.hm.Unlock()
+
+	for _, h := range handlers {
+		h(n)
+	}
+
+	for _, op := range n.Operations {
+		if op.Name == GET_COMPONENTS_ON_BUS {
+			continue
+		}
+
+		for _, t := range op.Targets {
+			if t.StatusCode != 0 || len(t.Parameters) == 0 {
+				continue
+			}
+
+			values, err := decodeValues(t.Parameters)
+			if err != nil {
+				s.logger().Warn("Parameters will be ignored", "component_id", t.Component, "error", err)
+				continue
+			}
+			s.notifyParameters(t.Component, values)
+		}
+	}
+}
+
+func (s *MQTTSession) notifyParameters(componentID string, values Values) {
+	s.hm.Lock()
+	handlers := s.paramHandlers
+	s.hm.Unlock()
+
+	for _, h := range handlers {
+		h(componentID, values)
+	}
+}
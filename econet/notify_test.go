@@ -0,0 +1,94 @@
+package econet_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+	"github.com/mtojek/spiroflex-vent-clear/econet/econettest"
+)
+
+// parametersPayload is a notification reporting the values of the component.
+func parametersPayload(t *testing.T, componentID string, values map[string]string) []byte {
+	t.Helper()
+
+	return rawJSON(t, map[string]any{
+		"operations": []econet.OperationResponse{
+			{Name: econet.GET_COMPONENTS_ON_BUS, Targets: []econet.TargetResponse{{Component: "9", Parameters: rawJSON(t, map[string]string{"componentName": "ignored"})}}},
+			{Name: econet.GET_VALUES, Targets: []econet.TargetResponse{
+				{Component: componentID, Parameters: rawJSON(t, values)},
+				{Component: "rejected", StatusCode: 3, Parameters: rawJSON(t, map[string]string{"u81": "1"})},
+			}},
+		},
+	})
+}
+
+func TestSubscribe(t *testing.T) {
+	broker := econettest.NewBroker()
+	session := newTestSession(t, broker)
+
+	var m sync.Mutex
+	var received []string
+	for _, name := range []string{"first", "second"} {
+		err := session.OnInstallationChange(func(n econet.Notification) {
+			m.Lock()
+			defer m.Unlock()
+
+			if len(n.Operations) != 1 || n.Operations[0].Name != econet.GET_VALUES {
+				t.Errorf("unexpected operations: %+v", n.Operations)
+			}
+			received = append(received, name+" "+n.Topic)
+		})
+		if err != nil {
+			t.Fatalf("OnInstallationChange failed: %v", err)
+		}
+	}
+
+	payload := rawJSON(t, map[string]any{"operations": []econet.OperationResponse{{Name: econet.GET_VALUES}}})
+	broker.Publish(testInstallationID+"/"+econet.TopicInstallationChanged, payload)
+	broker.Publish("other-installation/"+econet.TopicInstallationChanged, payload)
+	// Malformed notifications are ignored.
+	broker.Publish(testInstallationID+"/"+econet.TopicInstallationChanged, []byte("not json"))
+
+	m.Lock()
+	defer m.Unlock()
+	expected := []string{
+		"first " + testInstallationID + "/" + econet.TopicInstallationChanged,
+		"second " + testInstallationID + "/" + econet.TopicInstallationChanged,
+	}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("expected %v, got %v", expected, received)
+	}
+}
+
+func TestOnParameters(t *testing.T) {
+	broker := econettest.NewBroker()
+	session := newTestSession(t, broker)
+
+	var m sync.Mutex
+	received := map[string]econet.Values{}
+	err := session.OnParameters(func(componentID string, values econet.Values) {
+		m.Lock()
+		defer m.Unlock()
+
+		received[componentID] = values
+	})
+	if err != nil {
+		t.Fatalf("OnParameters failed: %v", err)
+	}
+
+	broker.Publish(testInstallationID+"/"+econet.TopicParametersChanged, parametersPayload(t, testComponentID, map[string]string{"u81": "2"}))
+	// Responses without a transaction ID are dispatched too.
+	broker.Publish(session.Diagnostics().Topics[0], parametersPayload(t, "2", map[string]string{"u6630": "1"}))
+
+	m.Lock()
+	defer m.Unlock()
+	expected := map[string]econet.Values{
+		testComponentID: {"u81": "2"},
+		"2":             {"u6630": "1"},
+	}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("expected %v, got %v", expected, received)
+	}
+}
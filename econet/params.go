@@ -0,0 +1,152 @@
+package econet
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type ParamType int
+
+const (
+	// ParamTypeEnum parameters accept one of the listed values.
+	ParamTypeEnum ParamType = iota
+	// ParamTypeBool parameters are encoded as "H1L0" (true) or "H0L1" (false).
+	ParamTypeBool
+	// ParamTypeInt parameters accept integers within the Min-Max range.
+	ParamTypeInt
+)
+
+const (
+	boolTrue  = "H1L0"
+	boolFalse = "H0L1"
+)
+
+// Param describes a known controller parameter and how its values are encoded.
+type Param struct {
+	ID   string
+	Name string
+	Type ParamType
+	Unit string
+
+	// Values maps human-readable values to encoded ones (ParamTypeEnum).
+	Values map[string]string
+	// True and False are human-readable labels of the boolean states (ParamTypeBool).
+	True, False string
+	// Min and Max limit accepted values (ParamTypeInt).
+	Min, Max int
+}
+
+var (
+	ParamVentLevel = Param{
+		ID:   "u81",
+		Name: "level",
+		Type: ParamTypeEnum,
+		Values: map[string]string{
+			"1":     "3",
+			"2":     "4",
+			"3":     "5",
+			"pause": "6",
+		},
+	}
+
+	ParamVentMode = Param{
+		ID:    "u6630",
+		Name:  "mode",
+		Type:  ParamTypeBool,
+		True:  "schedule",
+		False: "manual",
+	}
+
+	ParamVentPower = Param{
+		ID:    "u7074",
+		Name:  "power",
+		Type:  ParamTypeBool,
+		True:  "on",
+		False: "off",
+	}
+)
+
+// Params lists all known parameters.
+var Params = []Param{
+	ParamVentLevel,
+	ParamVentMode,
+	ParamVentPower,
+}
+
+// LookupParam finds a known parameter by its ID or name.
+func LookupParam(idOrName string) (Param, bool) {
+	i := slices.IndexFunc(Params, func(p Param) bool {
+		return p.ID == idOrName || p.Name == idOrName
+	})
+	if i < 0 {
+		return Param{}, false
+	}
+	return Params[i], true
+}
+
+// AllowedValues returns human-readable values accepted by Encode.
+func (p Param) AllowedValues() []string {
+	switch p.Type {
+	case ParamTypeEnum:
+		var values []string
+		for v := range p.Values {
+			values = append(values, v)
+		}
+		slices.Sort(values)
+		return values
+	case ParamTypeBool:
+		return []string{p.True, p.False}
+	case ParamTypeInt:
+		return []string{fmt.Sprintf("%d..%d", p.Min, p.Max)}
+	}
+	return nil
+}
+
+// Encode validates the human-readable value and translates it to the device representation.
+func (p Param) Encode(value string) (string, error) {
+	switch p.Type {
+	case ParamTypeEnum:
+		if encoded, ok := p.Values[value]; ok {
+			return encoded, nil
+		}
+	case ParamTypeBool:
+		switch value {
+		case p.True:
+			return boolTrue, nil
+		case p.False:
+			return boolFalse, nil
+		}
+	case ParamTypeInt:
+		i, err := strconv.Atoi(value)
+		if err == nil && i >= p.Min && i <= p.Max {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("%w %q for parameter %s, allowed: %s", ErrInvalidValue, value, p.Name, strings.Join(p.AllowedValues(), ", "))
+}
+
+// Decode translates the device representation to the human-readable value.
+func (p Param) Decode(raw string) (string, error) {
+	switch p.Type {
+	case ParamTypeEnum:
+		for value, encoded := range p.Values {
+			if encoded == raw {
+				return value, nil
+			}
+		}
+	case ParamTypeBool:
+		switch raw {
+		case boolTrue:
+			return p.True, nil
+		case boolFalse:
+			return p.False, nil
+		}
+	case ParamTypeInt:
+		if _, err := strconv.Atoi(raw); err == nil {
+			return raw, nil
+		}
+	}
+	return "", fmt.Errorf("unexpected value %q of parameter %s", raw, p.Name)
+}
@@ -0,0 +1,84 @@
+package econet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+)
+
+var (
+	// ErrUnconfirmedWrite is returned when raw parameters are written without a confirmation.
+	ErrUnconfirmedWrite = errors.New("writing raw parameters must be confirmed")
+	// ErrNoParams is returned when no raw parameters are given.
+	ErrNoParams = errors.New("no parameters given")
+	// ErrReadOnly is returned for raw operations that may modify the device.
+	ErrReadOnly = errors.New("only GET_COMPONENTS_ON_BUS and GET_VALUES operations are permitted")
+)
+
+// GetRawValues reads arbitrary parameters permitted by the guard.
+func (s *MQTTSession) GetRawValues(ctx context.Context, componentID string, guard spiroflex.RawParams, ids ...string) (Values, error) {
+	if len(ids) == 0 {
+		return nil, ErrNoParams
+	}
+	if err := guard.CheckRead(ids...); err != nil {
+		return nil, err
+	}
+	return s.GetValues(ctx, componentID, ids...)
+}
+
+// CheckReadOnly verifies that the operations only list components or read parameters
+// permitted by the guard. Parameters are written with SetRawValues.
+func CheckReadOnly(guard spiroflex.RawParams, ops []OperationRequest) error {
+	for _, op := range ops {
+		switch op.Name {
+		case GET_COMPONENTS_ON_BUS:
+		case GET_VALUES:
+			for _, target := range op.Targets {
+				b, err := json.Marshal(target.Parameters)
+				if err != nil {
+					return fmt.Errorf("can't marshal parameters: %w", err)
+				}
+				var ids []string
+				if err := json.Unmarshal(b, &ids); err != nil {
+					return fmt.Errorf("%s parameters must be a list of IDs: %w", op.Name, err)
+				}
+				if err := guard.CheckRead(ids...); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("%w, got %s", ErrReadOnly, op.Name)
+		}
+	}
+	return nil
+}
+
+// SetRawValues modifies arbitrary parameters permitted by the guard. Values of parameters
+// in the registry are checked before they're sent.
+func (s *MQTTSession) SetRawValues(ctx context.Context, componentID string, guard spiroflex.RawParams, values Values, confirm bool) error {
+	if !confirm {
+		return ErrUnconfirmedWrite
+	}
+	if len(values) == 0 {
+		return ErrNoParams
+	}
+
+	var ids []string
+	for id, raw := range values {
+		if p, ok := LookupParam(id); ok {
+			if _, err := p.Decode(raw); err != nil {
+				return fmt.Errorf("%w of parameter %s: %w", ErrInvalidValue, id, err)
+			}
+		}
+		ids = append(ids, id)
+	}
+	if err := guard.CheckWrite(ids...); err != nil {
+		return err
+	}
+
+	s.logger().Info("Writing raw parameters", "component_id", componentID, "values", values)
+	return s.SetValues(ctx, componentID, values)
+}
@@ -0,0 +1,102 @@
+package econet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	scheduleSlot  = 30 * time.Minute
+	scheduleSlots = 24 * 60 / 30
+)
+
+// ScheduleDays lists keys of WeeklySchedule and ScheduleParams in order.
+var ScheduleDays = []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}
+
+// ErrScheduleNotConfigured is returned when the parameter IDs of the schedule are unknown.
+var ErrScheduleNotConfigured = errors.New("device schedule parameters are not configured")
+
+// ScheduleParams maps days of the week to IDs of parameters holding their schedule.
+//
+// Experimental: neither the IDs nor the encoding have been verified on a real device. Days
+// are assumed to be masks of half-hour slots, the least significant bit being 00:00-00:30.
+// Values that don't fit the assumption are rejected rather than decoded. Until the encoding is
+// verified, the schedule is read-only.
+type ScheduleParams map[string]string
+
+// WeeklySchedule maps days of the week to intervals when the schedule is active.
+type WeeklySchedule map[string][]ScheduleInterval
+
+// ScheduleInterval is a period of a day, both ends formatted as HH:MM in half-hour steps.
+// To can be 24:00.
+type ScheduleInterval struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (p ScheduleParams) validate() error {
+	for _, day := range ScheduleDays {
+		if p[day] == "" {
+			return ErrScheduleNotConfigured
+		}
+	}
+	return nil
+}
+
+func (s *MQTTSession) GetSchedule(ctx context.Context, componentID string, params ScheduleParams) (WeeklySchedule, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, day := range ScheduleDays {
+		ids = append(ids, params[day])
+	}
+
+	values, err := s.GetValues(ctx, componentID, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := WeeklySchedule{}
+	for _, day := range ScheduleDays {
+		raw, ok := values[params[day]]
+		if !ok {
+			return nil, fmt.Errorf("missing schedule of %s", day)
+		}
+
+		mask, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil || mask >= 1<<scheduleSlots {
+			return nil, fmt.Errorf("unexpected schedule value of %s: %s", day, raw)
+		}
+		schedule[day] = decodeScheduleDay(mask)
+	}
+	return schedule, nil
+}
+
+func decodeScheduleDay(mask uint64) []ScheduleInterval {
+	intervals := []ScheduleInterval{}
+	for slot := 0; slot < scheduleSlots; slot++ {
+		if mask&(1<<slot) == 0 {
+			continue
+		}
+
+		from := slot
+		for slot < scheduleSlots && mask&(1<<slot) != 0 {
+			slot++
+		}
+		intervals = append(intervals, ScheduleInterval{
+			From: formatScheduleSlot(from),
+			To:   formatScheduleSlot(slot),
+		})
+	}
+	return intervals
+}
+
+func formatScheduleSlot(slot int) string {
+	d := time.Duration(slot) * scheduleSlot
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
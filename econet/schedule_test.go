@@ -0,0 +1,79 @@
+package econet_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+	"github.com/mtojek/spiroflex-vent-clear/econet/econettest"
+)
+
+var testScheduleParams = econet.ScheduleParams{
+	"mon": "s1", "tue": "s2", "wed": "s3", "thu": "s4", "fri": "s5", "sat": "s6", "sun": "s7",
+}
+
+func TestGetSchedule(t *testing.T) {
+	stored := map[string]string{
+		"s1": "35167192276992", "s2": "281474976710655", "s3": "0", "s4": "57344",
+		"s5": "57344", "s6": "70368743915520", "s7": "0",
+	}
+
+	broker := econettest.NewBroker()
+	broker.Handle(econettest.Respond(func(ops []econet.OperationRequest) []econet.OperationResponse {
+		return []econet.OperationResponse{{
+			Name:    econet.GET_VALUES,
+			Targets: []econet.TargetResponse{{Component: testComponentID, Parameters: rawJSON(t, stored)}},
+		}}
+	}))
+	session := newTestSession(t, broker)
+
+	got, err := session.GetSchedule(testContext(t), testComponentID, testScheduleParams)
+	if err != nil {
+		t.Fatalf("GetSchedule failed: %v", err)
+	}
+
+	expected := econet.WeeklySchedule{
+		"mon": {{From: "06:30", To: "08:00"}, {From: "17:00", To: "22:30"}},
+		"tue": {{From: "00:00", To: "24:00"}},
+		"wed": {},
+		"thu": {{From: "06:30", To: "08:00"}},
+		"fri": {{From: "06:30", To: "08:00"}},
+		"sat": {{From: "09:00", To: "23:00"}},
+		"sun": {},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestScheduleNotConfigured(t *testing.T) {
+	session := newTestSession(t, econettest.NewBroker())
+
+	_, err := session.GetSchedule(testContext(t), testComponentID, econet.ScheduleParams{"mon": "s1"})
+	if err != econet.ErrScheduleNotConfigured {
+		t.Errorf("expected ErrScheduleNotConfigured, got %v", err)
+	}
+}
+
+func TestScheduleUnexpectedValue(t *testing.T) {
+	broker := econettest.NewBroker()
+	broker.Handle(econettest.Respond(func(ops []econet.OperationRequest) []econet.OperationResponse {
+		values := map[string]string{}
+		for day, id := range testScheduleParams {
+			values[id] = "0"
+			if day == "mon" {
+				// Doesn't fit 48 half-hour slots.
+				values[id] = "281474976710656"
+			}
+		}
+		return []econet.OperationResponse{{
+			Name:    econet.GET_VALUES,
+			Targets: []econet.TargetResponse{{Component: testComponentID, Parameters: rawJSON(t, values)}},
+		}}
+	}))
+	session := newTestSession(t, broker)
+
+	if _, err := session.GetSchedule(testContext(t), testComponentID, testScheduleParams); err == nil {
+		t.Error("expected error for a value that isn't a mask of half-hour slots")
+	}
+}
@@ -0,0 +1,72 @@
+package econet
+
+import (
+	"maps"
+	"sync"
+	"time"
+)
+
+// DeviceState keeps the last known parameter values of components of all installations.
+// Component IDs are unique only within an installation.
+type DeviceState struct {
+	m          sync.RWMutex
+	components map[componentKey]ComponentState
+}
+
+type componentKey struct {
+	installationID string
+	componentID    string
+}
+
+// ComponentState is the last known parameter values of a component.
+type ComponentState struct {
+	Values    Values    `json:"values"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func NewDeviceState() *DeviceState {
+	return &DeviceState{
+		components: map[componentKey]ComponentState{},
+	}
+}
+
+// Update merges values into the state of the component of the installation.
+func (ds *DeviceState) Update(installationID, componentID string, values Values) {
+	ds.m.Lock()
+	defer ds.m.Unlock()
+
+	key := componentKey{installationID: installationID, componentID: componentID}
+	cs, ok := ds.components[key]
+	if !ok {
+		cs.Values = Values{}
+	}
+	maps.Copy(cs.Values, values)
+	cs.UpdatedAt = time.Now()
+	ds.components[key] = cs
+}
+
+// Values returns a copy of the last known component values and the time of the last update.
+func (ds *DeviceState) Values(installationID, componentID string) (Values, time.Time) {
+	ds.m.RLock()
+	defer ds.m.RUnlock()
+
+	cs, ok := ds.components[componentKey{installationID: installationID, componentID: componentID}]
+	if !ok {
+		return nil, time.Time{}
+	}
+	return maps.Clone(cs.Values), cs.UpdatedAt
+}
+
+// Components returns copies of the state of all known components of the installation, by component ID.
+func (ds *DeviceState) Components(installationID string) map[string]ComponentState {
+	ds.m.RLock()
+	defer ds.m.RUnlock()
+
+	components := map[string]ComponentState{}
+	for key, cs := range ds.components {
+		if key.installationID == installationID {
+			components[key.componentID] = ComponentState{Values: maps.Clone(cs.Values), UpdatedAt: cs.UpdatedAt}
+		}
+	}
+	return components
+}
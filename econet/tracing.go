@@ -0,0 +1,16 @@
+package econet
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var tracer = otel.Tracer("github.com/mtojek/spiroflex-vent-clear/econet")
+
+// Span attributes of installation requests.
+const (
+	attrInstallationID = attribute.Key("econet.installation_id")
+	attrClientID       = attribute.Key("econet.client_id")
+	attrTransactionID  = attribute.Key("econet.transaction_id")
+	attrOperation      = attribute.Key("econet.operation")
+)
@@ -0,0 +1,72 @@
+package econet_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+	"github.com/mtojek/spiroflex-vent-clear/econet/econettest"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recorder is installed once, as tracers of the package keep delegating to the first global provider.
+var recorder = sync.OnceValue(func() *tracetest.SpanRecorder {
+	r := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(r)))
+	return r
+})
+
+func TestTracing(t *testing.T) {
+	recorder := recorder()
+
+	broker := econettest.NewBroker()
+	broker.Handle(econettest.Respond(func(ops []econet.OperationRequest) []econet.OperationResponse {
+		return []econet.OperationResponse{{Name: econet.GET_COMPONENTS_ON_BUS}}
+	}))
+	session := newTestSession(t, broker)
+
+	ctx, parent := otel.Tracer("test").Start(testContext(t), "parent")
+	_, err := session.SendInstallationRequest(ctx, []econet.OperationRequest{{Name: econet.GET_COMPONENTS_ON_BUS}})
+	if err != nil {
+		t.Fatalf("SendInstallationRequest failed: %v", err)
+	}
+	parent.End()
+
+	connected := false
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		connected = connected || s.Name() == "econet.MQTT"
+		if s.SpanContext().TraceID() == parent.SpanContext().TraceID() {
+			spans[s.Name()] = s
+		}
+	}
+	if !connected {
+		t.Error("econet.MQTT span not recorded")
+	}
+
+	span, ok := spans["econet.SendInstallationRequest"]
+	if !ok {
+		t.Fatal("econet.SendInstallationRequest span not recorded")
+	}
+	if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("expected parent span %s, got %s", parent.SpanContext().SpanID(), span.Parent().SpanID())
+	}
+
+	attrs := map[attribute.Key]string{}
+	for _, a := range span.Attributes() {
+		attrs[a.Key] = a.Value.Emit()
+	}
+	expected := map[attribute.Key]string{
+		"econet.installation_id": testInstallationID,
+		"econet.transaction_id":  "1",
+		"econet.operation":       econet.GET_COMPONENTS_ON_BUS,
+	}
+	for k, v := range expected {
+		if attrs[k] != v {
+			t.Errorf("expected attribute %s=%s, got %q", k, v, attrs[k])
+		}
+	}
+}
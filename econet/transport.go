@@ -0,0 +1,220 @@
+package econet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	signer "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/mtojek/spiroflex-vent-clear"
+)
+
+// HTTPDoer sends requests to the installation API.
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// CredentialsProvider supplies AWS credentials of the Cognito identity.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (aws.Credentials, error)
+	IdentityID() string
+}
+
+// ConnectionEvents are callbacks invoked by the MQTT transport.
+type ConnectionEvents struct {
+	OnReconnect      func()
+	OnConnectionLost func(err error)
+}
+
+// Dialer opens MQTT connections.
+type Dialer interface {
+	Dial(ctx context.Context, clientID string, events ConnectionEvents) (PubSub, error)
+}
+
+// PubSub is an open MQTT connection.
+type PubSub interface {
+	Publish(topic string, payload []byte) error
+	Subscribe(topic string, handler func(topic string, payload []byte)) error
+	// IsConnectionOpen reports whether the connection is currently open.
+	IsConnectionOpen() bool
+	// IsConnected reports whether the connection is open or being reestablished.
+	IsConnected() bool
+	// ExpiresAt returns the expiry of credentials used to open the connection, zero if they don't expire.
+	ExpiresAt() time.Time
+	Disconnect()
+}
+
+// Transport bundles the dependencies of Client.
+type Transport struct {
+	Credentials CredentialsProvider
+	HTTP        HTTPDoer
+	MQTT        Dialer
+}
+
+// AWSTransport returns the transport talking to Cognito, API Gateway and AWS IoT.
+func AWSTransport(ctx context.Context, cfg *spiroflex.Config) (*Transport, error) {
+	creds, err := newCognitoCredentials(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transport{
+		Credentials: creds,
+		HTTP:        http.DefaultClient,
+		MQTT: &pahoDialer{
+			cfg:   cfg,
+			creds: creds,
+		},
+	}, nil
+}
+
+type pahoDialer struct {
+	cfg   *spiroflex.Config
+	creds CredentialsProvider
+}
+
+func (d *pahoDialer) Dial(ctx context.Context, clientID string, events ConnectionEvents) (PubSub, error) {
+	signedURL, expiresAt, err := d.presignURL(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &pahoConn{
+		expiresAt: expiresAt,
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(signedURL).
+		SetClientID(clientID).
+		SetProtocolVersion(3).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(mqttMaxReconnectInterval).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			if events.OnConnectionLost != nil {
+				events.OnConnectionLost(err)
+			}
+		}).
+		SetOnConnectHandler(func(_ mqtt.Client) {
+			if conn.connected.Swap(true) && events.OnReconnect != nil {
+				events.OnReconnect()
+			}
+		}).
+		SetReconnectingHandler(func(_ mqtt.Client, opts *mqtt.ClientOptions) {
+			ctx, cancel := context.WithTimeout(context.Background(), mqttConnectTimeout)
+			defer cancel()
+
+			signedURL, expiresAt, err := d.presignURL(ctx)
+			if err != nil {
+				slog.Warn("MQTT client will reconnect using the previous URL, unable to presign a new one", "client_id", clientID, "error", err)
+				return
+			}
+
+			u, err := url.Parse(signedURL)
+			if err != nil {
+				slog.Warn("MQTT client will reconnect using the previous URL, unable to parse a new one", "client_id", clientID, "error", err)
+				return
+			}
+			opts.Servers = []*url.URL{u}
+
+			conn.m.Lock()
+			conn.expiresAt = expiresAt
+			conn.m.Unlock()
+		})
+
+	conn.client = mqtt.NewClient(opts)
+	token := conn.client.Connect()
+	if !token.WaitTimeout(mqttConnectTimeout) {
+		return nil, errors.New("connection to MQTT broker timed out")
+	}
+	if token.Error() != nil {
+		return nil, fmt.Errorf("unable to connect to MQTT broker: %w", token.Error())
+	}
+	return conn, nil
+}
+
+func (d *pahoDialer) presignURL(ctx context.Context) (string, time.Time, error) {
+	creds, err := d.creds.Credentials(ctx)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("unable to obtain credentials: %w", err)
+	}
+
+	// AWS IoT expects the session token to be appended after signing.
+	s := signer.NewSigner()
+	awsCreds := creds
+	awsCreds.SessionToken = ""
+
+	mqttURL := fmt.Sprintf("wss://%s.iot.%s.amazonaws.com/mqtt", d.cfg.IoT.Name, d.cfg.Region)
+	if d.cfg.Endpoints.IoT != "" {
+		mqttURL = d.cfg.Endpoints.IoT
+	}
+	req, err := http.NewRequest("GET", mqttURL, nil)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("can't build HTTP request: %w", err)
+	}
+
+	signedURL, _, err := s.PresignHTTP(ctx, awsCreds, req, payloadHash, "iotdevicegateway", d.cfg.Region, time.Now())
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("unable to presign MQTT URL: %w", err)
+	}
+
+	if creds.SessionToken != "" {
+		signedURL += "&X-Amz-Security-Token=" + url.QueryEscape(creds.SessionToken)
+	}
+	return signedURL, creds.Expires, nil
+}
+
+type pahoConn struct {
+	client    mqtt.Client
+	connected atomic.Bool
+
+	m         sync.Mutex
+	expiresAt time.Time
+}
+
+func (c *pahoConn) Publish(topic string, payload []byte) error {
+	token := c.client.Publish(topic, 1, false, payload)
+	if !token.WaitTimeout(mqttPublishTimeout) {
+		return errors.New("publish timeout")
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("publish error: %w", err)
+	}
+	return nil
+}
+
+func (c *pahoConn) Subscribe(topic string, handler func(topic string, payload []byte)) error {
+	t := c.client.Subscribe(topic, 1, func(_ mqtt.Client, msg mqtt.Message) {
+		handler(msg.Topic(), msg.Payload())
+	})
+	if !t.WaitTimeout(mqttSubscribeTimeout) {
+		return errors.New("subscribe timeout")
+	}
+	return t.Error()
+}
+
+func (c *pahoConn) IsConnectionOpen() bool {
+	return c.client.IsConnectionOpen()
+}
+
+func (c *pahoConn) IsConnected() bool {
+	return c.client.IsConnected()
+}
+
+func (c *pahoConn) ExpiresAt() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.expiresAt
+}
+
+func (c *pahoConn) Disconnect() {
+	c.client.Disconnect(100)
+}
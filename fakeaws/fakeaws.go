@@ -0,0 +1,325 @@
+// Package fakeaws implements enough of Cognito user pools (USER_SRP_AUTH, REFRESH_TOKEN_AUTH),
+// Cognito identity pools and the installations API Gateway to run econet offline.
+package fakeaws
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+)
+
+type Options struct {
+	Region         string
+	UserPoolID     string
+	ClientID       string
+	IdentityPoolID string
+
+	Username string
+	Password string
+
+	Installations []econet.Installation
+
+	// TokenTTL and CredentialsTTL default to an hour like in AWS.
+	TokenTTL       time.Duration
+	CredentialsTTL time.Duration
+	// NoCredentialsExpiration omits the expiration of AWS credentials.
+	NoCredentialsExpiration bool
+}
+
+type Server struct {
+	*httptest.Server
+
+	opts Options
+
+	m             sync.Mutex
+	srpSessions   map[string]*srpSession
+	idTokens      map[string]time.Time
+	refreshTokens map[string]bool
+	accessKeys    map[string]time.Time
+	identityID    string
+
+	srpAttempts       int
+	srpLogins         int
+	refreshes         int
+	credentialsIssued int
+}
+
+func NewServer(opts Options) *Server {
+	if opts.TokenTTL == 0 {
+		opts.TokenTTL = time.Hour
+	}
+	if opts.CredentialsTTL == 0 {
+		opts.CredentialsTTL = time.Hour
+	}
+
+	s := &Server{
+		opts:          opts,
+		srpSessions:   map[string]*srpSession{},
+		idTokens:      map[string]time.Time{},
+		refreshTokens: map[string]bool{},
+		accessKeys:    map[string]time.Time{},
+		identityID:    opts.Region + ":" + randomHex(16),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /", s.serveAWSJSON)
+	mux.HandleFunc("GET /Prod/get-installations", s.serveInstallations)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// SRPAttempts returns the number of USER_SRP_AUTH authentications, including failed ones.
+func (s *Server) SRPAttempts() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.srpAttempts
+}
+
+// CredentialsIssued returns the number of AWS credentials issued by GetCredentialsForIdentity.
+func (s *Server) CredentialsIssued() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.credentialsIssued
+}
+
+// SRPLogins returns the number of successful USER_SRP_AUTH authentications.
+func (s *Server) SRPLogins() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.srpLogins
+}
+
+// Refreshes returns the number of successful REFRESH_TOKEN_AUTH authentications.
+func (s *Server) Refreshes() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.refreshes
+}
+
+type authenticationResult struct {
+	AccessToken  string `json:"AccessToken"`
+	ExpiresIn    int32  `json:"ExpiresIn"`
+	IdToken      string `json:"IdToken"`
+	RefreshToken string `json:"RefreshToken,omitempty"`
+	TokenType    string `json:"TokenType"`
+}
+
+func (s *Server) serveAWSJSON(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AuthFlow           string
+		AuthParameters     map[string]string
+		ChallengeName      string
+		ChallengeResponses map[string]string
+		ClientId           string
+		IdentityPoolId     string
+		IdentityId         string
+		Logins             map[string]string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAWSError(w, "InvalidParameterException", err.Error())
+		return
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	switch r.Header.Get("X-Amz-Target") {
+	case "AWSCognitoIdentityProviderService.InitiateAuth":
+		if req.ClientId != s.opts.ClientID {
+			writeAWSError(w, "ResourceNotFoundException", "User pool client does not exist.")
+			return
+		}
+
+		switch req.AuthFlow {
+		case "USER_SRP_AUTH":
+			s.srpAttempts++
+			s.initiateSRPAuth(w, req.AuthParameters)
+		case "REFRESH_TOKEN_AUTH":
+			if !s.refreshTokens[req.AuthParameters["REFRESH_TOKEN"]] {
+				writeAWSError(w, "NotAuthorizedException", "Invalid Refresh Token.")
+				return
+			}
+			s.refreshes++
+			writeAWSJSON(w, map[string]any{"AuthenticationResult": s.issueTokens(false)})
+		default:
+			writeAWSError(w, "InvalidParameterException", "Unsupported auth flow: "+req.AuthFlow)
+		}
+	case "AWSCognitoIdentityProviderService.RespondToAuthChallenge":
+		s.respondToAuthChallenge(w, req.ChallengeName, req.ChallengeResponses)
+	case "AWSCognitoIdentityService.GetId":
+		if req.IdentityPoolId != s.opts.IdentityPoolID {
+			writeAWSError(w, "ResourceNotFoundException", "IdentityPool not found.")
+			return
+		}
+		if !s.validLogins(req.Logins) {
+			writeAWSError(w, "NotAuthorizedException", "Invalid login token.")
+			return
+		}
+		writeAWSJSON(w, map[string]any{"IdentityId": s.identityID})
+	case "AWSCognitoIdentityService.GetCredentialsForIdentity":
+		if req.IdentityId != s.identityID {
+			writeAWSError(w, "ResourceNotFoundException", "Identity not found.")
+			return
+		}
+		if !s.validLogins(req.Logins) {
+			writeAWSError(w, "NotAuthorizedException", "Invalid login token.")
+			return
+		}
+
+		accessKeyID := "ASIA" + strings.ToUpper(randomHex(8))
+		expiration := time.Now().Add(s.opts.CredentialsTTL)
+		credentials := map[string]any{
+			"AccessKeyId":  accessKeyID,
+			"SecretKey":    randomHex(20),
+			"SessionToken": randomHex(32),
+		}
+		if s.opts.NoCredentialsExpiration {
+			expiration = time.Now().AddDate(100, 0, 0)
+		} else {
+			credentials["Expiration"] = expiration.Unix()
+		}
+		s.accessKeys[accessKeyID] = expiration
+		s.credentialsIssued++
+		writeAWSJSON(w, map[string]any{
+			"IdentityId":  s.identityID,
+			"Credentials": credentials,
+		})
+	default:
+		writeAWSError(w, "UnknownOperationException", "Unknown operation: "+r.Header.Get("X-Amz-Target"))
+	}
+}
+
+func (s *Server) initiateSRPAuth(w http.ResponseWriter, params map[string]string) {
+	if params["USERNAME"] != s.opts.Username {
+		writeAWSError(w, "UserNotFoundException", "User does not exist.")
+		return
+	}
+
+	poolName := s.opts.UserPoolID[strings.Index(s.opts.UserPoolID, "_")+1:]
+	session, err := newSRPSession(poolName, s.opts.Username, s.opts.Password, params["SRP_A"])
+	if err != nil {
+		writeAWSError(w, "InvalidParameterException", err.Error())
+		return
+	}
+
+	secretBlock := base64.StdEncoding.EncodeToString([]byte(randomHex(32)))
+	s.srpSessions[secretBlock] = session
+
+	writeAWSJSON(w, map[string]any{
+		"ChallengeName": "PASSWORD_VERIFIER",
+		"ChallengeParameters": map[string]string{
+			"SALT":            session.salt.Text(16),
+			"SECRET_BLOCK":    secretBlock,
+			"SRP_B":           session.bigB.Text(16),
+			"USERNAME":        s.opts.Username,
+			"USER_ID_FOR_SRP": s.opts.Username,
+		},
+	})
+}
+
+func (s *Server) respondToAuthChallenge(w http.ResponseWriter, challengeName string, responses map[string]string) {
+	if challengeName != "PASSWORD_VERIFIER" {
+		writeAWSError(w, "InvalidParameterException", "Unsupported challenge: "+challengeName)
+		return
+	}
+
+	secretBlockB64 := responses["PASSWORD_CLAIM_SECRET_BLOCK"]
+	session, ok := s.srpSessions[secretBlockB64]
+	if !ok {
+		writeAWSError(w, "NotAuthorizedException", "Invalid session.")
+		return
+	}
+	delete(s.srpSessions, secretBlockB64)
+
+	secretBlock, _ := base64.StdEncoding.DecodeString(secretBlockB64)
+	signature, _ := base64.StdEncoding.DecodeString(responses["PASSWORD_CLAIM_SIGNATURE"])
+	if !session.verify(string(secretBlock), responses["TIMESTAMP"], signature) {
+		writeAWSError(w, "NotAuthorizedException", "Incorrect username or password.")
+		return
+	}
+
+	s.srpLogins++
+	writeAWSJSON(w, map[string]any{
+		"AuthenticationResult": s.issueTokens(true),
+		"ChallengeParameters":  map[string]string{},
+	})
+}
+
+func (s *Server) issueTokens(withRefreshToken bool) authenticationResult {
+	result := authenticationResult{
+		AccessToken: randomHex(32),
+		ExpiresIn:   int32(s.opts.TokenTTL / time.Second),
+		IdToken:     randomHex(32),
+		TokenType:   "Bearer",
+	}
+	s.idTokens[result.IdToken] = time.Now().Add(s.opts.TokenTTL)
+
+	if withRefreshToken {
+		result.RefreshToken = randomHex(32)
+		s.refreshTokens[result.RefreshToken] = true
+	}
+	return result
+}
+
+func (s *Server) validLogins(logins map[string]string) bool {
+	provider := fmt.Sprintf("cognito-idp.%s.amazonaws.com/%s", s.opts.Region, s.opts.UserPoolID)
+	expiresAt, ok := s.idTokens[logins[provider]]
+	return ok && time.Now().Before(expiresAt)
+}
+
+var credentialRegexp = regexp.MustCompile(`Credential=([A-Z0-9]+)/`)
+
+func (s *Server) serveInstallations(w http.ResponseWriter, r *http.Request) {
+	m := credentialRegexp.FindStringSubmatch(r.Header.Get("Authorization"))
+
+	s.m.Lock()
+	var expiresAt time.Time
+	if m != nil {
+		expiresAt = s.accessKeys[m[1]]
+	}
+	s.m.Unlock()
+
+	if time.Now().After(expiresAt) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message":"The security token included in the request is expired"}`))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.opts.Installations)
+}
+
+func writeAWSJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAWSError(w http.ResponseWriter, errorType, message string) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	w.Header().Set("X-Amzn-ErrorType", errorType)
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{
+		"__type":  errorType,
+		"message": message,
+	})
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
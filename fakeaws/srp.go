@@ -0,0 +1,140 @@
+package fakeaws
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// SRP constants used by Cognito user pools.
+const (
+	nHex = "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1" +
+		"29024E088A67CC74020BBEA63B139B22514A08798E3404DD" +
+		"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245" +
+		"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3D" +
+		"C2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F" +
+		"83655D23DCA3AD961C62F356208552BB9ED529077096966D" +
+		"670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+		"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9" +
+		"DE2BCBF6955817183995497CEA956AE515D2261898FA0510" +
+		"15728E5A8AAAC42DAD33170D04507A33A85521ABDF1CBA64" +
+		"ECFB850458DBEF0A8AEA71575D060C7DB3970F85A6E1E4C7" +
+		"ABF5AE8CDB0933D71E8C94E04A25619DCEE3D2261AD2EE6B" +
+		"F12FFA06D98A0864D87602733EC86A64521F2B18177B200C" +
+		"BBE117577A615D6C770988C0BAD946E208E24FA074E5AB31" +
+		"43DB5BFCE0FD108E4B82D120A93AD2CAFFFFFFFFFFFFFFFF"
+	gHex     = "2"
+	infoBits = "Caldera Derived Key"
+)
+
+var (
+	bigN = hexToBig(nHex)
+	g    = hexToBig(gHex)
+	k    = hexToBig(hexHash("00" + nHex + "0" + gHex))
+)
+
+// srpSession is the server side of a single USER_SRP_AUTH exchange.
+type srpSession struct {
+	poolName string
+	userID   string
+	salt     *big.Int
+	verifier *big.Int
+
+	bigA *big.Int
+	b    *big.Int
+	bigB *big.Int
+}
+
+func newSRPSession(poolName, userID, password, srpA string) (*srpSession, error) {
+	bigA, ok := new(big.Int).SetString(srpA, 16)
+	if !ok || new(big.Int).Mod(bigA, bigN).Sign() == 0 {
+		return nil, fmt.Errorf("invalid SRP_A")
+	}
+
+	salt := randomBig(16)
+	userPassHash := hashSha256([]byte(poolName + userID + ":" + password))
+	x := hexToBig(hexHash(padHex(salt.Text(16)) + userPassHash))
+	verifier := new(big.Int).Exp(g, x, bigN)
+
+	b := new(big.Int).Mod(randomBig(128), bigN)
+	bigB := new(big.Int).Mul(k, verifier)
+	bigB.Add(bigB, new(big.Int).Exp(g, b, bigN))
+	bigB.Mod(bigB, bigN)
+
+	return &srpSession{
+		poolName: poolName,
+		userID:   userID,
+		salt:     salt,
+		verifier: verifier,
+		bigA:     bigA,
+		b:        b,
+		bigB:     bigB,
+	}, nil
+}
+
+// verify checks the PASSWORD_CLAIM_SIGNATURE computed by the client.
+func (s *srpSession) verify(secretBlock, timestamp string, signature []byte) bool {
+	u := hexToBig(hexHash(padHex(s.bigA.Text(16)) + padHex(s.bigB.Text(16))))
+
+	// S = (A * v^u) ^ b mod N
+	sVal := new(big.Int).Exp(s.verifier, u, bigN)
+	sVal.Mul(sVal, s.bigA)
+	sVal.Exp(sVal, s.b, bigN)
+
+	key := computeHKDF(padHex(sVal.Text(16)), padHex(u.Text(16)))
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s.poolName + s.userID + secretBlock + timestamp))
+	return hmac.Equal(mac.Sum(nil), signature)
+}
+
+func hashSha256(buf []byte) string {
+	h := sha256.Sum256(buf)
+	return hex.EncodeToString(h[:])
+}
+
+func hexHash(hexStr string) string {
+	buf, _ := hex.DecodeString(hexStr)
+	return hashSha256(buf)
+}
+
+func hexToBig(hexStr string) *big.Int {
+	i, ok := new(big.Int).SetString(hexStr, 16)
+	if !ok {
+		panic(fmt.Sprintf("unable to convert %q to big.Int", hexStr))
+	}
+	return i
+}
+
+func randomBig(n int) *big.Int {
+	b := make([]byte, n)
+	rand.Read(b)
+	return new(big.Int).SetBytes(b)
+}
+
+func padHex(hexStr string) string {
+	if len(hexStr)%2 == 1 {
+		return "0" + hexStr
+	}
+	if strings.Contains("89ABCDEFabcdef", hexStr[:1]) {
+		return "00" + hexStr
+	}
+	return hexStr
+}
+
+func computeHKDF(ikm, salt string) []byte {
+	ikmb, _ := hex.DecodeString(ikm)
+	saltb, _ := hex.DecodeString(salt)
+
+	extractor := hmac.New(sha256.New, saltb)
+	extractor.Write(ikmb)
+	prk := extractor.Sum(nil)
+
+	expander := hmac.New(sha256.New, prk)
+	expander.Write(append([]byte(infoBits), 1))
+	return expander.Sum(nil)[:16]
+}
@@ -0,0 +1,149 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+)
+
+const redacted = "[REDACTED]"
+
+// New returns a logger writing to w in the configured format and level. Secrets of the config,
+// presigned URL parameters and bearer tokens are redacted from messages and attributes.
+func New(w io.Writer, c *spiroflex.Config) (*slog.Logger, error) {
+	var level slog.Level
+	if c.Log.Level != "" {
+		if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+			return nil, fmt.Errorf("invalid log level: %w", err)
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch c.Log.Format {
+	case "", spiroflex.LogFormatText:
+		h = slog.NewTextHandler(w, opts)
+	case spiroflex.LogFormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format: %s", c.Log.Format)
+	}
+	return slog.New(&redactingHandler{next: h, redactor: NewRedactor(secrets(c)...)}), nil
+}
+
+func secrets(c *spiroflex.Config) []string {
+	secrets := []string{c.Cognito.Password}
+	for _, t := range c.API.Auth.Tokens {
+		secrets = append(secrets, t.Token)
+	}
+	return secrets
+}
+
+var patterns = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	// Presigned URLs, e.g. of the MQTT broker.
+	{regexp.MustCompile(`(?i)(X-Amz-(?:Security-Token|Signature|Credential)=)[^&\s"]+`), "${1}" + redacted},
+	{regexp.MustCompile(`(?i)\b(Bearer|Basic) [A-Za-z0-9._~+/=-]+`), "${1} " + redacted},
+	// JWTs, e.g. Cognito ID tokens, and 5-segment JWEs, e.g. Cognito refresh tokens.
+	{regexp.MustCompile(`eyJ[\w-]+(?:\.[\w-]+){2,4}`), redacted},
+}
+
+// sensitiveKeys mark attributes whose values are always redacted.
+var sensitiveKeys = []string{"password", "secret", "token", "authorization", "credential"}
+
+// Redactor removes secrets from log output.
+type Redactor struct {
+	secrets []string
+}
+
+func NewRedactor(secrets ...string) *Redactor {
+	r := &Redactor{}
+	for _, s := range secrets {
+		if s != "" {
+			r.secrets = append(r.secrets, s)
+		}
+	}
+	return r
+}
+
+// String returns s with secrets replaced.
+func (r *Redactor) String(s string) string {
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	for _, p := range patterns {
+		s = p.re.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// Attr returns the attribute with secrets replaced in its value, or the whole value
+// replaced if its key suggests it's sensitive.
+func (r *Redactor) Attr(a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, k := range sensitiveKeys {
+		if strings.Contains(key, k) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, r.String(v.String()))
+	case slog.KindGroup:
+		attrs := v.Group()
+		redactedAttrs := make([]slog.Attr, 0, len(attrs))
+		for _, ga := range attrs {
+			redactedAttrs = append(redactedAttrs, r.Attr(ga))
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(redactedAttrs...)}
+	case slog.KindAny:
+		switch x := v.Any().(type) {
+		case error:
+			return slog.String(a.Key, r.String(x.Error()))
+		case fmt.Stringer:
+			return slog.String(a.Key, r.String(x.String()))
+		case []byte:
+			return slog.String(a.Key, r.String(string(x)))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+type redactingHandler struct {
+	next     slog.Handler
+	redactor *Redactor
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	redactedRecord := slog.NewRecord(r.Time, r.Level, h.redactor.String(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redactedRecord.AddAttrs(h.redactor.Attr(a))
+		return true
+	})
+	return h.next.Handle(ctx, redactedRecord)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redactedAttrs := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		redactedAttrs = append(redactedAttrs, h.redactor.Attr(a))
+	}
+	return &redactingHandler{next: h.next.WithAttrs(redactedAttrs), redactor: h.redactor}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{next: h.next.WithGroup(name), redactor: h.redactor}
+}
@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+)
+
+func TestRedaction(t *testing.T) {
+	c := &spiroflex.Config{
+		Cognito: spiroflex.CognitoConfig{Password: "hunter2"},
+		API: spiroflex.API{
+			Auth: spiroflex.Auth{Tokens: []spiroflex.AuthToken{{Token: "s3cr3t-api-token"}}},
+		},
+	}
+	tests := []struct {
+		name   string
+		log    func(l *slog.Logger)
+		secret string
+	}{
+		{
+			name: "presigned URL",
+			log: func(l *slog.Logger) {
+				l.Info("Connecting", "url", "wss://broker/mqtt?X-Amz-Credential=AKIA&X-Amz-Security-Token=FwoGZXIvYXdzE&X-Amz-Signature=abc123")
+			},
+			secret: "FwoGZXIvYXdzE",
+		},
+		{
+			name:   "bearer token in message",
+			log:    func(l *slog.Logger) { l.Info("Authorization: Bearer abc.def.ghi") },
+			secret: "abc.def.ghi",
+		},
+		{
+			name: "JWT in error",
+			log: func(l *slog.Logger) {
+				l.Error("Refresh failed", "error", errors.New("invalid eyJhbGciOi.eyJzdWIiOi.c2lnbmF0dXJl"))
+			},
+			secret: "eyJhbGciOi",
+		},
+		{
+			name: "JWE in error",
+			log: func(l *slog.Logger) {
+				l.Error("Refresh failed", "error", errors.New("invalid eyJjdHkiOi.a2V5.aXY.Y2lwaGVydGV4dA.dGFn"))
+			},
+			secret: "Y2lwaGVydGV4dA",
+		},
+		{
+			name:   "sensitive key",
+			log:    func(l *slog.Logger) { l.Info("Login", "password", "plain") },
+			secret: "plain",
+		},
+		{
+			name:   "config password",
+			log:    func(l *slog.Logger) { l.With("user", "joe").Warn("Login with hunter2 failed") },
+			secret: "hunter2",
+		},
+		{
+			name:   "API token in group",
+			log:    func(l *slog.Logger) { l.Info("Request", slog.Group("request", "query", "t=s3cr3t-api-token")) },
+			secret: "s3cr3t-api-token",
+		},
+	}
+
+	for _, format := range []string{spiroflex.LogFormatText, spiroflex.LogFormatJSON} {
+		for _, tt := range tests {
+			t.Run(format+"/"+tt.name, func(t *testing.T) {
+				var buf bytes.Buffer
+				c.Log.Format = format
+				l, err := New(&buf, c)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				tt.log(l)
+				if strings.Contains(buf.String(), tt.secret) {
+					t.Errorf("secret %q not redacted: %s", tt.secret, buf.String())
+				}
+				if !strings.Contains(buf.String(), redacted) {
+					t.Errorf("expected %s in: %s", redacted, buf.String())
+				}
+			})
+		}
+	}
+}
+
+func TestLevel(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := New(&buf, &spiroflex.Config{Log: spiroflex.Log{Level: "warn"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l.Info("hidden")
+	l.Warn("shown")
+	if strings.Contains(buf.String(), "hidden") || !strings.Contains(buf.String(), "shown") {
+		t.Errorf("unexpected output: %s", buf.String())
+	}
+
+	if _, err := New(&buf, &spiroflex.Config{Log: spiroflex.Log{Level: "verbose"}}); err == nil {
+		t.Error("expected error for invalid level")
+	}
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ventclear"
+
+// Registry holds all metrics of the bridge, along with Go runtime and process metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by route and method.",
+		Buckets:   []float64{.005, .01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"route", "method"})
+
+	CognitoAuthAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cognito_auth_attempts_total",
+		Help:      "Cognito authentication attempts by flow (srp, refresh).",
+	}, []string{"flow"})
+
+	CognitoAuthFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cognito_auth_failures_total",
+		Help:      "Failed Cognito authentication attempts by flow (srp, refresh).",
+	}, []string{"flow"})
+
+	MQTTConnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mqtt_connects_total",
+		Help:      "MQTT sessions opened.",
+	})
+
+	MQTTReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mqtt_reconnects_total",
+		Help:      "Automatic reconnections of MQTT sessions.",
+	})
+
+	MQTTConnectionLosses = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mqtt_connection_losses_total",
+		Help:      "Lost MQTT connections.",
+	})
+
+	MQTTRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mqtt_request_duration_seconds",
+		Help:      "Round-trip time of installation requests by operation and result (ok, error, timeout).",
+		Buckets:   []float64{.1, .25, .5, 1, 2, 5, 10, 30},
+	}, []string{"operation", "result"})
+
+	MQTTPendingTransactions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "mqtt_pending_transactions",
+		Help:      "Installation requests waiting for a response.",
+	}, []string{"installation"})
+
+	DeviceLevel = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "device_level",
+		Help:      "Current fan level of the device, 0 when paused.",
+	}, []string{"installation", "component"})
+
+	DeviceScheduleMode = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "device_schedule_mode",
+		Help:      "1 if the device runs in schedule mode, 0 in manual mode.",
+	}, []string{"installation", "component"})
+
+	DevicePower = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "device_power",
+		Help:      "1 if the device is powered on.",
+	}, []string{"installation", "component"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+
+		HTTPRequests,
+		HTTPRequestDuration,
+		CognitoAuthAttempts,
+		CognitoAuthFailures,
+		MQTTConnects,
+		MQTTReconnects,
+		MQTTConnectionLosses,
+		MQTTRequestDuration,
+		MQTTPendingTransactions,
+		DeviceLevel,
+		DeviceScheduleMode,
+		DevicePower,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,153 @@
+package scheduler
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+var dayAliases = map[string][]string{
+	"weekdays": {"mon", "tue", "wed", "thu", "fri"},
+	"weekends": {"sat", "sun"},
+	"daily":    {"mon", "tue", "wed", "thu", "fri", "sat", "sun"},
+}
+
+// Rule applies the action at the time of the listed days, e.g. weekdays at 07:00 level 2.
+type Rule struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name,omitempty"`
+	Days     []string `json:"days"`
+	Time     string   `json:"time"`
+	Action   Action   `json:"action"`
+	Disabled bool     `json:"disabled,omitempty"`
+}
+
+// Action sets any combination of the level ("1"-"3", "pause"), mode and power.
+type Action struct {
+	Level string `json:"level,omitempty"`
+	Mode  string `json:"mode,omitempty"`
+	Power string `json:"power,omitempty"`
+}
+
+// Override suspends rules between From and Until, e.g. while on holiday. The optional
+// action is applied when the override starts.
+type Override struct {
+	ID     string    `json:"id"`
+	Name   string    `json:"name,omitempty"`
+	From   time.Time `json:"from"`
+	Until  time.Time `json:"until"`
+	Action *Action   `json:"action,omitempty"`
+}
+
+func (a Action) String() string {
+	var parts []string
+	if a.Power != "" {
+		parts = append(parts, "power "+a.Power)
+	}
+	if a.Mode != "" {
+		parts = append(parts, "mode "+a.Mode)
+	}
+	if a.Level != "" {
+		parts = append(parts, "level "+a.Level)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (a Action) validate() error {
+	if a.Level == "" && a.Mode == "" && a.Power == "" {
+		return fmt.Errorf("action must set level, mode or power")
+	}
+	if a.Level != "" && a.Mode == econet.ParamVentMode.True {
+		return fmt.Errorf("level can't be set in schedule mode")
+	}
+
+	values := []struct {
+		param econet.Param
+		value string
+	}{
+		{econet.ParamVentPower, a.Power},
+		{econet.ParamVentMode, a.Mode},
+		{econet.ParamVentLevel, a.Level},
+	}
+	for _, v := range values {
+		if v.value == "" {
+			continue
+		}
+		if _, err := v.param.Encode(v.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Rule) validate() error {
+	if len(r.Days) == 0 {
+		return fmt.Errorf("rule must have days")
+	}
+
+	var days []string
+	for _, d := range r.Days {
+		d = strings.ToLower(d)
+		if alias, ok := dayAliases[d]; ok {
+			days = append(days, alias...)
+			continue
+		}
+		if _, ok := weekdays[d]; !ok {
+			return fmt.Errorf("invalid day: %s", d)
+		}
+		days = append(days, d)
+	}
+	slices.SortFunc(days, func(a, b string) int {
+		return int(weekdays[a]) - int(weekdays[b])
+	})
+	r.Days = slices.Compact(days)
+
+	if _, _, err := r.clock(); err != nil {
+		return err
+	}
+	return r.Action.validate()
+}
+
+func (r *Rule) clock() (int, int, error) {
+	t, err := time.Parse("15:04", r.Time)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time %q, expected HH:MM", r.Time)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+func (r *Rule) runsOn(day time.Weekday) bool {
+	return slices.ContainsFunc(r.Days, func(d string) bool {
+		return weekdays[d] == day
+	})
+}
+
+func (o *Override) validate() error {
+	if o.From.IsZero() || o.Until.IsZero() {
+		return fmt.Errorf("override must have from and until")
+	}
+	if !o.Until.After(o.From) {
+		return fmt.Errorf("override must end after it starts")
+	}
+	if o.Action != nil {
+		return o.Action.validate()
+	}
+	return nil
+}
+
+func (o *Override) active(t time.Time) bool {
+	return !t.Before(o.From) && t.Before(o.Until)
+}
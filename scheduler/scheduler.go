@@ -0,0 +1,404 @@
+// Package scheduler applies user-defined weekly rules to the ventilation.
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	tickInterval = 15 * time.Second
+	applyTimeout = 30 * time.Second
+
+	// previewHorizon limits how far the transitions are searched.
+	previewHorizon = 366 * 24 * time.Hour
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	// ErrInvalid is returned for rules and overrides that can't be applied.
+	ErrInvalid = errors.New("invalid")
+)
+
+// Vent applies actions of rules and overrides, the scheduler never reads the state of the unit.
+type Vent interface {
+	SetLevel(ctx context.Context, level string) error
+	SetMode(ctx context.Context, mode string) error
+	SetPower(ctx context.Context, power string) error
+}
+
+// Transition is a planned application of an action.
+type Transition struct {
+	At         time.Time `json:"at"`
+	RuleID     string    `json:"ruleId,omitempty"`
+	OverrideID string    `json:"overrideId,omitempty"`
+	Action     *Action   `json:"action,omitempty"`
+	// Suspended transitions are skipped due to an active override.
+	Suspended bool `json:"suspended,omitempty"`
+}
+
+type Scheduler struct {
+	vent Vent
+	path string
+	now  func() time.Time
+
+	m         sync.Mutex
+	rules     []Rule
+	overrides []Override
+	lastCheck time.Time
+}
+
+type store struct {
+	Rules     []Rule     `json:"rules"`
+	Overrides []Override `json:"overrides"`
+}
+
+// New creates the scheduler persisting rules in the file at path.
+func New(vent Vent, path string) *Scheduler {
+	return &Scheduler{
+		vent: vent,
+		path: path,
+		now:  time.Now,
+	}
+}
+
+// Load reads persisted rules and overrides.
+func (s *Scheduler) Load() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("can't read scheduler state: %w", err)
+	}
+
+	var st store
+	if err := json.Unmarshal(data, &st); err != nil {
+		return fmt.Errorf("can't unmarshal scheduler state: %w", err)
+	}
+	s.rules = st.Rules
+	s.overrides = st.Overrides
+	return nil
+}
+
+// Run applies due transitions until the context is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.m.Lock()
+	s.lastCheck = s.now()
+	s.m.Unlock()
+
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.tick(ctx)
+		}
+	}
+}
+
+func (s *Scheduler) tick(ctx context.Context) {
+	s.m.Lock()
+	now := s.now()
+	due := s.transitions(s.lastCheck, now, -1)
+	s.lastCheck = now
+	s.removeExpiredOverrides(now)
+	s.m.Unlock()
+
+	for _, t := range due {
+		if t.Suspended || t.Action == nil {
+			continue
+		}
+
+		slog.Info("Scheduler applies action", "action", t.Action.String(), "rule_id", t.RuleID, "override_id", t.OverrideID)
+		// Transitions being applied when Run is stopped are completed, not interrupted.
+		actx, cancel := context.WithTimeout(context.WithoutCancel(ctx), applyTimeout)
+		err := s.apply(actx, *t.Action)
+		cancel()
+		if err != nil {
+			slog.Error("Scheduler can't apply action", "action", t.Action.String(), "rule_id", t.RuleID, "override_id", t.OverrideID, "error", err)
+		}
+	}
+}
+
+func (s *Scheduler) apply(ctx context.Context, a Action) error {
+	if a.Power != "" {
+		if err := s.vent.SetPower(ctx, a.Power); err != nil {
+			return err
+		}
+	}
+	if a.Mode != "" {
+		if err := s.vent.SetMode(ctx, a.Mode); err != nil {
+			return err
+		}
+	}
+	if a.Level != "" {
+		if err := s.vent.SetLevel(ctx, a.Level); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Preview returns the next n transitions without applying them.
+func (s *Scheduler) Preview(n int) []Transition {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	from := s.now()
+	return s.transitions(from, from.Add(previewHorizon), n)
+}
+
+// transitions returns transitions in (from, to], at most limit of them unless limit is negative.
+func (s *Scheduler) transitions(from, to time.Time, limit int) []Transition {
+	result := []Transition{}
+
+	for day := startOfDay(from); !day.After(to); day = day.AddDate(0, 0, 1) {
+		daily := s.ruleTransitions(day, from, to)
+		for i := range daily {
+			daily[i].Suspended = s.suspended(daily[i].At)
+		}
+
+		dayEnd := day.AddDate(0, 0, 1)
+		for _, o := range s.overrides {
+			if inWindow(o.From, from, to) && !o.From.Before(day) && o.From.Before(dayEnd) {
+				daily = append(daily, Transition{At: o.From, OverrideID: o.ID, Action: o.Action})
+			}
+			if inWindow(o.Until, from, to) && !o.Until.Before(day) && o.Until.Before(dayEnd) && !s.suspended(o.Until) {
+				daily = append(daily, Transition{At: o.Until, OverrideID: o.ID, Action: s.resumedAction(o.Until)})
+			}
+		}
+
+		slices.SortStableFunc(daily, func(a, b Transition) int {
+			return a.At.Compare(b.At)
+		})
+		result = append(result, daily...)
+		if limit >= 0 && len(result) >= limit {
+			return result[:limit]
+		}
+	}
+	return result
+}
+
+// ruleTransitions returns sorted transitions of enabled rules on the day, limited to (from, to].
+func (s *Scheduler) ruleTransitions(day, from, to time.Time) []Transition {
+	var transitions []Transition
+	for _, r := range s.rules {
+		if r.Disabled || !r.runsOn(day.Weekday()) {
+			continue
+		}
+
+		hour, minute, err := r.clock()
+		if err != nil {
+			continue
+		}
+		at := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location())
+		if !inWindow(at, from, to) {
+			continue
+		}
+
+		action := r.Action
+		transitions = append(transitions, Transition{At: at, RuleID: r.ID, Action: &action})
+	}
+
+	slices.SortStableFunc(transitions, func(a, b Transition) int {
+		return a.At.Compare(b.At)
+	})
+	return transitions
+}
+
+func (s *Scheduler) suspended(t time.Time) bool {
+	return slices.ContainsFunc(s.overrides, func(o Override) bool {
+		return o.active(t)
+	})
+}
+
+// resumedAction returns the action of the latest rule preceding t, restored when an override ends.
+func (s *Scheduler) resumedAction(t time.Time) *Action {
+	weekAgo := t.AddDate(0, 0, -7)
+	for day := startOfDay(t); day.After(weekAgo.AddDate(0, 0, -1)); day = day.AddDate(0, 0, -1) {
+		transitions := s.ruleTransitions(day, weekAgo, t)
+		if len(transitions) > 0 {
+			return transitions[len(transitions)-1].Action
+		}
+	}
+	return nil
+}
+
+func (s *Scheduler) removeExpiredOverrides(now time.Time) {
+	n := len(s.overrides)
+	s.overrides = slices.DeleteFunc(s.overrides, func(o Override) bool {
+		return !o.Until.After(now)
+	})
+	if len(s.overrides) != n {
+		if err := s.save(s.rules, s.overrides); err != nil {
+			slog.Error("Scheduler can't save state", "error", err)
+		}
+	}
+}
+
+func (s *Scheduler) Rules() []Rule {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	// Not nil, so no rules are listed as an empty JSON array.
+	return append([]Rule{}, s.rules...)
+}
+
+func (s *Scheduler) Rule(id string) (*Rule, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	i := slices.IndexFunc(s.rules, func(r Rule) bool { return r.ID == id })
+	if i < 0 {
+		return nil, fmt.Errorf("rule %s %w", id, ErrNotFound)
+	}
+	r := s.rules[i]
+	return &r, nil
+}
+
+func (s *Scheduler) AddRule(r Rule) (*Rule, error) {
+	if err := r.validate(); err != nil {
+		return nil, fmt.Errorf("%w rule: %w", ErrInvalid, err)
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	r.ID = newID()
+	rules := append(slices.Clone(s.rules), r)
+	if err := s.save(rules, s.overrides); err != nil {
+		return nil, err
+	}
+	s.rules = rules
+	return &r, nil
+}
+
+func (s *Scheduler) UpdateRule(id string, r Rule) (*Rule, error) {
+	if err := r.validate(); err != nil {
+		return nil, fmt.Errorf("%w rule: %w", ErrInvalid, err)
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	i := slices.IndexFunc(s.rules, func(r Rule) bool { return r.ID == id })
+	if i < 0 {
+		return nil, fmt.Errorf("rule %s %w", id, ErrNotFound)
+	}
+	r.ID = id
+	rules := slices.Clone(s.rules)
+	rules[i] = r
+	if err := s.save(rules, s.overrides); err != nil {
+		return nil, err
+	}
+	s.rules = rules
+	return &r, nil
+}
+
+func (s *Scheduler) DeleteRule(id string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	i := slices.IndexFunc(s.rules, func(r Rule) bool { return r.ID == id })
+	if i < 0 {
+		return fmt.Errorf("rule %s %w", id, ErrNotFound)
+	}
+	rules := slices.Delete(slices.Clone(s.rules), i, i+1)
+	if err := s.save(rules, s.overrides); err != nil {
+		return err
+	}
+	s.rules = rules
+	return nil
+}
+
+func (s *Scheduler) Overrides() []Override {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return append([]Override{}, s.overrides...)
+}
+
+func (s *Scheduler) AddOverride(o Override) (*Override, error) {
+	if err := o.validate(); err != nil {
+		return nil, fmt.Errorf("%w override: %w", ErrInvalid, err)
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	o.ID = newID()
+	overrides := append(slices.Clone(s.overrides), o)
+	if err := s.save(s.rules, overrides); err != nil {
+		return nil, err
+	}
+	s.overrides = overrides
+	return &o, nil
+}
+
+func (s *Scheduler) DeleteOverride(id string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	i := slices.IndexFunc(s.overrides, func(o Override) bool { return o.ID == id })
+	if i < 0 {
+		return fmt.Errorf("override %s %w", id, ErrNotFound)
+	}
+	overrides := slices.Delete(slices.Clone(s.overrides), i, i+1)
+	if err := s.save(s.rules, overrides); err != nil {
+		return err
+	}
+	s.overrides = overrides
+	return nil
+}
+
+// save persists the rules and overrides, they're committed in memory only after it succeeds.
+func (s *Scheduler) save(rules []Rule, overrides []Override) error {
+	data, err := json.MarshalIndent(store{Rules: rules, Overrides: overrides}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can't marshal scheduler state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("can't create state directory: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("can't write scheduler state: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("can't replace scheduler state: %w", err)
+	}
+	return nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func inWindow(t, from, to time.Time) bool {
+	return t.After(from) && !t.After(to)
+}
+
+func newID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
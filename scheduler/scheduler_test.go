@@ -0,0 +1,200 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeVent struct {
+	m     sync.Mutex
+	calls []string
+}
+
+func (v *fakeVent) record(call string) error {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	v.calls = append(v.calls, call)
+	return nil
+}
+
+func (v *fakeVent) SetLevel(ctx context.Context, level string) error {
+	return v.record("level " + level)
+}
+func (v *fakeVent) SetMode(ctx context.Context, mode string) error { return v.record("mode " + mode) }
+func (v *fakeVent) SetPower(ctx context.Context, power string) error {
+	return v.record("power " + power)
+}
+
+// monday is Monday, 6 January 2025, 06:00 UTC.
+var monday = time.Date(2025, time.January, 6, 6, 0, 0, 0, time.UTC)
+
+func newTestScheduler(t *testing.T) (*Scheduler, *fakeVent) {
+	t.Helper()
+
+	vent := &fakeVent{}
+	s := New(vent, filepath.Join(t.TempDir(), "scheduler.json"))
+	s.now = func() time.Time { return monday }
+
+	for _, r := range []Rule{
+		{Days: []string{"weekdays"}, Time: "07:00", Action: Action{Level: "2"}},
+		{Days: []string{"daily"}, Time: "23:00", Action: Action{Level: "pause"}},
+		{Days: []string{"sat", "sun"}, Time: "09:00", Action: Action{Mode: "schedule"}},
+	} {
+		if _, err := s.AddRule(r); err != nil {
+			t.Fatalf("AddRule failed: %v", err)
+		}
+	}
+	return s, vent
+}
+
+func describe(transitions []Transition) []string {
+	var result []string
+	for _, t := range transitions {
+		d := t.At.Format("Mon 15:04")
+		if t.Action != nil {
+			d += " " + t.Action.String()
+		}
+		if t.Suspended {
+			d += " (suspended)"
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+func TestPreview(t *testing.T) {
+	s, _ := newTestScheduler(t)
+
+	expected := []string{
+		"Mon 07:00 level 2",
+		"Mon 23:00 level pause",
+		"Tue 07:00 level 2",
+		"Tue 23:00 level pause",
+	}
+	if got := describe(s.Preview(4)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestPreviewWithOverride(t *testing.T) {
+	s, _ := newTestScheduler(t)
+
+	_, err := s.AddOverride(Override{
+		From:   monday.Add(12 * time.Hour),
+		Until:  monday.Add(36 * time.Hour),
+		Action: &Action{Power: "off"},
+	})
+	if err != nil {
+		t.Fatalf("AddOverride failed: %v", err)
+	}
+
+	expected := []string{
+		"Mon 07:00 level 2",
+		"Mon 18:00 power off",
+		"Mon 23:00 level pause (suspended)",
+		"Tue 07:00 level 2 (suspended)",
+		"Tue 18:00 level 2",
+		"Tue 23:00 level pause",
+	}
+	if got := describe(s.Preview(6)); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestTick(t *testing.T) {
+	s, vent := newTestScheduler(t)
+	s.lastCheck = monday
+
+	s.now = func() time.Time { return monday.Add(90 * time.Minute) }
+	s.tick(context.Background())
+
+	s.now = func() time.Time { return monday.Add(2 * time.Hour) }
+	s.tick(context.Background())
+
+	if expected := []string{"level 2"}; !reflect.DeepEqual(vent.calls, expected) {
+		t.Errorf("expected calls %v, got %v", expected, vent.calls)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{name: "no days", rule: Rule{Time: "07:00", Action: Action{Level: "1"}}},
+		{name: "invalid day", rule: Rule{Days: []string{"someday"}, Time: "07:00", Action: Action{Level: "1"}}},
+		{name: "invalid time", rule: Rule{Days: []string{"mon"}, Time: "25:00", Action: Action{Level: "1"}}},
+		{name: "empty action", rule: Rule{Days: []string{"mon"}, Time: "07:00"}},
+		{name: "invalid level", rule: Rule{Days: []string{"mon"}, Time: "07:00", Action: Action{Level: "4"}}},
+		{name: "level in schedule mode", rule: Rule{Days: []string{"mon"}, Time: "07:00", Action: Action{Level: "1", Mode: "schedule"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestScheduler(t)
+			if _, err := s.AddRule(tt.rule); err == nil {
+				t.Error("expected validation error")
+			}
+		})
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	s, _ := newTestScheduler(t)
+
+	loaded := New(&fakeVent{}, s.path)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Rules(), s.Rules()) {
+		t.Errorf("expected rules %+v, got %+v", s.Rules(), loaded.Rules())
+	}
+}
+
+func TestFailingStore(t *testing.T) {
+	s, _ := newTestScheduler(t)
+	rules := s.Rules()
+
+	// The state can't be written under a regular file.
+	s.path = filepath.Join(s.path, "scheduler.json")
+
+	if _, err := s.AddRule(Rule{Days: []string{"daily"}, Time: "12:00", Action: Action{Level: "1"}}); err == nil {
+		t.Error("expected AddRule to fail")
+	}
+	if _, err := s.UpdateRule(rules[0].ID, Rule{Days: []string{"daily"}, Time: "12:00", Action: Action{Level: "1"}}); err == nil {
+		t.Error("expected UpdateRule to fail")
+	}
+	if err := s.DeleteRule(rules[0].ID); err == nil {
+		t.Error("expected DeleteRule to fail")
+	}
+	if _, err := s.AddOverride(Override{From: monday, Until: monday.Add(time.Hour), Action: &Action{Level: "3"}}); err == nil {
+		t.Error("expected AddOverride to fail")
+	}
+
+	if !reflect.DeepEqual(s.Rules(), rules) {
+		t.Errorf("expected unchanged rules %+v, got %+v", rules, s.Rules())
+	}
+	if overrides := s.Overrides(); len(overrides) != 0 {
+		t.Errorf("expected no overrides, got %+v", overrides)
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	s := New(&fakeVent{}, filepath.Join(t.TempDir(), "scheduler.json"))
+
+	for name, v := range map[string]any{"rules": s.Rules(), "overrides": s.Overrides(), "preview": s.Preview(5)} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("json.Marshal failed: %v", err)
+		}
+		if string(b) != "[]" {
+			t.Errorf("expected empty %s to be [], got %s", name, b)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+const brokerTimeout = 10 * time.Second
+
+// Broker is an embedded MQTT broker accepting all clients.
+type Broker struct {
+	server *mochi.Server
+}
+
+// NewBroker starts the broker listening for TCP and websocket connections. Empty addresses are skipped.
+func NewBroker(tcpAddr, wsAddr string) (*Broker, error) {
+	server := mochi.New(&mochi.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+
+	err := server.AddHook(new(auth.AllowHook), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to add auth hook: %w", err)
+	}
+
+	if tcpAddr != "" {
+		err = server.AddListener(listeners.NewTCP(listeners.Config{ID: "tcp", Address: tcpAddr}))
+		if err != nil {
+			return nil, fmt.Errorf("unable to add TCP listener: %w", err)
+		}
+	}
+	if wsAddr != "" {
+		err = server.AddListener(listeners.NewWebsocket(listeners.Config{ID: "ws", Address: wsAddr}))
+		if err != nil {
+			return nil, fmt.Errorf("unable to add websocket listener: %w", err)
+		}
+	}
+
+	err = server.Serve()
+	if err != nil {
+		return nil, fmt.Errorf("unable to start broker: %w", err)
+	}
+	return &Broker{server: server}, nil
+}
+
+func (b *Broker) Publish(topic string, payload []byte) error {
+	return b.server.Publish(topic, payload, false, 1)
+}
+
+func (b *Broker) Subscribe(filter string, handler func(topic string, payload []byte)) error {
+	return b.server.Subscribe(filter, 1, func(_ *mochi.Client, _ packets.Subscription, pk packets.Packet) {
+		handler(pk.TopicName, pk.Payload)
+	})
+}
+
+func (b *Broker) Close() error {
+	return b.server.Close()
+}
+
+// Client is a connection to an external MQTT broker.
+type Client struct {
+	client mqtt.Client
+}
+
+func Dial(brokerURL, clientID string) (*Client, error) {
+	opts := mqtt.NewClientOptions().
+		AddBroker(brokerURL).
+		SetClientID(clientID).
+		SetAutoReconnect(true)
+
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	if !token.WaitTimeout(brokerTimeout) {
+		return nil, errors.New("connection to MQTT broker timed out")
+	}
+	if token.Error() != nil {
+		return nil, fmt.Errorf("unable to connect to MQTT broker: %w", token.Error())
+	}
+	return &Client{client: client}, nil
+}
+
+func (c *Client) Publish(topic string, payload []byte) error {
+	token := c.client.Publish(topic, 1, false, payload)
+	if !token.WaitTimeout(brokerTimeout) {
+		return errors.New("publish timeout")
+	}
+	return token.Error()
+}
+
+func (c *Client) Subscribe(filter string, handler func(topic string, payload []byte)) error {
+	token := c.client.Subscribe(filter, 1, func(_ mqtt.Client, msg mqtt.Message) {
+		handler(msg.Topic(), msg.Payload())
+	})
+	if !token.WaitTimeout(brokerTimeout) {
+		return errors.New("subscribe timeout")
+	}
+	return token.Error()
+}
+
+func (c *Client) Close() error {
+	c.client.Disconnect(100)
+	return nil
+}
@@ -0,0 +1,240 @@
+package simulator
+
+import (
+	"encoding/json"
+	"maps"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+)
+
+// Status codes reported by the simulated device.
+const (
+	StatusOK               = 0
+	StatusInvalidValue     = 1
+	StatusUnknownParameter = 2
+	StatusUnknownComponent = 3
+	StatusUnknownOperation = 4
+)
+
+const (
+	VentComponentName   = "ecoVENT MINI OEM"
+	ModuleComponentName = "ecoNET300"
+)
+
+type Options struct {
+	ComponentID string
+
+	// Latency and Jitter delay every response.
+	Latency time.Duration
+	Jitter  time.Duration
+
+	// ErrorRate is the probability that a target of an operation fails with ErrorStatusCode.
+	ErrorRate       float64
+	ErrorStatusCode int
+	// DropRate is the probability that a request isn't answered at all.
+	DropRate float64
+}
+
+// Device is a stateful model of the ecoVENT MINI OEM and the ecoNET module it is connected to.
+type Device struct {
+	opts Options
+
+	m      sync.Mutex
+	values econet.Values
+}
+
+type component struct {
+	id   string
+	info econet.ComponentOnBus
+}
+
+func NewDevice(opts Options) *Device {
+	if opts.ComponentID == "" {
+		opts.ComponentID = "1"
+	}
+	if opts.ErrorStatusCode == 0 {
+		opts.ErrorStatusCode = StatusInvalidValue
+	}
+
+	level, _ := econet.ParamVentLevel.Encode("1")
+	mode, _ := econet.ParamVentMode.Encode("schedule")
+	power, _ := econet.ParamVentPower.Encode("on")
+
+	return &Device{
+		opts: opts,
+		values: econet.Values{
+			econet.ParamVentLevel.ID: level,
+			econet.ParamVentMode.ID:  mode,
+			econet.ParamVentPower.ID: power,
+		},
+	}
+}
+
+// Values returns a copy of the current parameter values.
+func (d *Device) Values() econet.Values {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	return maps.Clone(d.values)
+}
+
+func (d *Device) components() []component {
+	return []component{
+		{
+			id: "0",
+			info: econet.ComponentOnBus{
+				ComponentName:   ModuleComponentName,
+				ClientID:        0,
+				HardwareVersion: "3.2",
+				ProgramSeries:   "SIM",
+				DeviceStatus:    1,
+				ZDVersion:       "3.2.3879",
+			},
+		},
+		{
+			id: d.opts.ComponentID,
+			info: econet.ComponentOnBus{
+				ComponentName:   VentComponentName,
+				ClientID:        1,
+				DPVersion:       "1.0",
+				HardwareVersion: "1.1",
+				ProgramSeries:   "SIM",
+				DeviceStatus:    1,
+			},
+		},
+	}
+}
+
+type operationRequest struct {
+	Name    string          `json:"name"`
+	Targets []targetRequest `json:"targets,omitempty"`
+}
+
+type targetRequest struct {
+	Component  string          `json:"component"`
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+}
+
+type operationResponse struct {
+	Name    string           `json:"name"`
+	Targets []targetResponse `json:"targets,omitempty"`
+
+	StatusCode int `json:"statusCode"`
+}
+
+type targetResponse struct {
+	Component  string `json:"component"`
+	Parameters any    `json:"parameters,omitempty"`
+
+	StatusCode int `json:"statusCode"`
+}
+
+// Handle executes operations and returns responses with values modified by them.
+func (d *Device) Handle(ops []operationRequest) ([]operationResponse, econet.Values) {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	changed := econet.Values{}
+	var resp []operationResponse
+	for _, op := range ops {
+		r := operationResponse{Name: op.Name}
+		switch op.Name {
+		case econet.GET_COMPONENTS_ON_BUS:
+			for _, c := range d.components() {
+				r.Targets = append(r.Targets, targetResponse{
+					Component:  c.id,
+					Parameters: c.info,
+					StatusCode: d.failure(),
+				})
+			}
+		case econet.GET_VALUES:
+			for _, t := range op.Targets {
+				r.Targets = append(r.Targets, d.getValues(t))
+			}
+		case econet.PARAMS_MODIFICATION:
+			for _, t := range op.Targets {
+				r.Targets = append(r.Targets, d.modifyParams(t, changed))
+			}
+		default:
+			r.StatusCode = StatusUnknownOperation
+		}
+		resp = append(resp, r)
+	}
+	return resp, changed
+}
+
+func (d *Device) getValues(t targetRequest) targetResponse {
+	if t.Component != d.opts.ComponentID {
+		return targetResponse{Component: t.Component, StatusCode: StatusUnknownComponent}
+	}
+
+	var ids []string
+	if err := json.Unmarshal(t.Parameters, &ids); err != nil {
+		return targetResponse{Component: t.Component, StatusCode: StatusInvalidValue}
+	}
+
+	values := econet.Values{}
+	for _, id := range ids {
+		v, ok := d.values[id]
+		if !ok {
+			return targetResponse{Component: t.Component, StatusCode: StatusUnknownParameter}
+		}
+		values[id] = v
+	}
+
+	if code := d.failure(); code != StatusOK {
+		return targetResponse{Component: t.Component, StatusCode: code}
+	}
+	return targetResponse{Component: t.Component, Parameters: values}
+}
+
+func (d *Device) modifyParams(t targetRequest, changed econet.Values) targetResponse {
+	if t.Component != d.opts.ComponentID {
+		return targetResponse{Component: t.Component, StatusCode: StatusUnknownComponent}
+	}
+
+	var values map[string]string
+	if err := json.Unmarshal(t.Parameters, &values); err != nil {
+		return targetResponse{Component: t.Component, StatusCode: StatusInvalidValue}
+	}
+
+	for id, v := range values {
+		p, ok := econet.LookupParam(id)
+		if !ok {
+			return targetResponse{Component: t.Component, StatusCode: StatusUnknownParameter}
+		}
+		if _, err := p.Decode(v); err != nil {
+			return targetResponse{Component: t.Component, StatusCode: StatusInvalidValue}
+		}
+	}
+
+	if code := d.failure(); code != StatusOK {
+		return targetResponse{Component: t.Component, StatusCode: code}
+	}
+
+	maps.Copy(d.values, values)
+	maps.Copy(changed, values)
+	return targetResponse{Component: t.Component}
+}
+
+func (d *Device) failure() int {
+	if d.opts.ErrorRate > 0 && rand.Float64() < d.opts.ErrorRate {
+		return d.opts.ErrorStatusCode
+	}
+	return StatusOK
+}
+
+func (d *Device) delay() (time.Duration, bool) {
+	if d.opts.DropRate > 0 && rand.Float64() < d.opts.DropRate {
+		return 0, false
+	}
+
+	delay := d.opts.Latency
+	if d.opts.Jitter > 0 {
+		delay += rand.N(d.opts.Jitter)
+	}
+	return delay, true
+}
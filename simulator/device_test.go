@@ -0,0 +1,87 @@
+package simulator
+
+import (
+	"encoding/json"
+	"maps"
+	"testing"
+
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+)
+
+func TestDeviceHandle(t *testing.T) {
+	tests := []struct {
+		name       string
+		op         operationRequest
+		opts       Options
+		statusCode int
+		changed    econet.Values
+	}{
+		{
+			name: "modify level",
+			op: operationRequest{
+				Name:    econet.PARAMS_MODIFICATION,
+				Targets: []targetRequest{{Component: "1", Parameters: json.RawMessage(`{"u81":"5"}`)}},
+			},
+			changed: econet.Values{"u81": "5"},
+		},
+		{
+			name: "invalid value",
+			op: operationRequest{
+				Name:    econet.PARAMS_MODIFICATION,
+				Targets: []targetRequest{{Component: "1", Parameters: json.RawMessage(`{"u81":"9"}`)}},
+			},
+			statusCode: StatusInvalidValue,
+		},
+		{
+			name: "unknown parameter",
+			op: operationRequest{
+				Name:    econet.PARAMS_MODIFICATION,
+				Targets: []targetRequest{{Component: "1", Parameters: json.RawMessage(`{"u1":"1"}`)}},
+			},
+			statusCode: StatusUnknownParameter,
+		},
+		{
+			name: "unknown component",
+			op: operationRequest{
+				Name:    econet.GET_VALUES,
+				Targets: []targetRequest{{Component: "7", Parameters: json.RawMessage(`["u81"]`)}},
+			},
+			statusCode: StatusUnknownComponent,
+		},
+		{
+			name: "configured error",
+			op: operationRequest{
+				Name:    econet.PARAMS_MODIFICATION,
+				Targets: []targetRequest{{Component: "1", Parameters: json.RawMessage(`{"u7074":"H0L1"}`)}},
+			},
+			opts:       Options{ErrorRate: 1, ErrorStatusCode: 42},
+			statusCode: 42,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDevice(tt.opts)
+			before := d.Values()
+
+			resp, changed := d.Handle([]operationRequest{tt.op})
+			if len(resp) != 1 || len(resp[0].Targets) != 1 {
+				t.Fatalf("unexpected response: %+v", resp)
+			}
+			if code := resp[0].Targets[0].StatusCode; code != tt.statusCode {
+				t.Errorf("expected status code %d, got %d", tt.statusCode, code)
+			}
+			if len(changed) != len(tt.changed) {
+				t.Fatalf("expected changed values %v, got %v", tt.changed, changed)
+			}
+			for id, v := range tt.changed {
+				if changed[id] != v || d.Values()[id] != v {
+					t.Errorf("parameter %s: expected %s, got %s", id, v, d.Values()[id])
+				}
+			}
+			if len(tt.changed) == 0 && !maps.Equal(d.Values(), before) {
+				t.Errorf("values shouldn't change: %v", d.Values())
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// Package simulator emulates an ecoNET installation with the ecoVENT MINI OEM unit,
+// speaking the installationRequest/installationResponse protocol over MQTT.
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/mtojek/spiroflex-vent-clear/econet"
+)
+
+// PubSub is the MQTT connection used by the simulator.
+type PubSub interface {
+	Publish(topic string, payload []byte) error
+	Subscribe(filter string, handler func(topic string, payload []byte)) error
+}
+
+type Simulator struct {
+	device *Device
+	ps     PubSub
+}
+
+func New(device *Device, ps PubSub) *Simulator {
+	return &Simulator{
+		device: device,
+		ps:     ps,
+	}
+}
+
+// Start subscribes to installation requests of all installations and clients.
+func (s *Simulator) Start() error {
+	err := s.ps.Subscribe("+/+/installationRequest", s.onRequest)
+	if err != nil {
+		return fmt.Errorf("unable to subscribe to installation requests: %w", err)
+	}
+	return nil
+}
+
+func (s *Simulator) onRequest(topic string, payload []byte) {
+	slog.Debug("Request received", "topic", topic, "payload", string(payload))
+
+	var req struct {
+		TransactionID string             `json:"transactionId"`
+		Operations    []operationRequest `json:"operations,omitempty"`
+	}
+	if err := json.Unmarshal(payload, &req); err != nil {
+		slog.Warn("Request will be ignored", "error", err)
+		return
+	}
+
+	prefix := strings.TrimSuffix(topic, "/installationRequest")
+	installationID, _, _ := strings.Cut(prefix, "/")
+
+	delay, ok := s.device.delay()
+	if !ok {
+		slog.Info("Request will be dropped", "transaction_id", req.TransactionID)
+		return
+	}
+
+	go func() {
+		time.Sleep(delay)
+
+		ops, changed := s.device.Handle(req.Operations)
+		s.publish(prefix+"/installationResponse", struct {
+			TransactionID string              `json:"transactionId"`
+			Operations    []operationResponse `json:"operations,omitempty"`
+		}{
+			TransactionID: req.TransactionID,
+			Operations:    ops,
+		})
+
+		if len(changed) > 0 {
+			s.publish(installationID+"/"+econet.TopicParametersChanged, struct {
+				Operations []operationResponse `json:"operations"`
+			}{
+				Operations: []operationResponse{
+					{
+						Name: econet.GET_VALUES,
+						Targets: []targetResponse{
+							{Component: s.device.opts.ComponentID, Parameters: changed},
+						},
+					},
+				},
+			})
+		}
+	}()
+}
+
+func (s *Simulator) publish(topic string, v any) {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("Message can't be marshalled", "error", err)
+		return
+	}
+
+	slog.Debug("Publish message", "topic", topic, "payload", string(msg))
+	if err := s.ps.Publish(topic, msg); err != nil {
+		slog.Error("Message can't be published", "topic", topic, "error", err)
+	}
+}
@@ -0,0 +1,83 @@
+package systemd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// States sent to the service manager.
+const (
+	Ready     = "READY=1"
+	Stopping  = "STOPPING=1"
+	Heartbeat = "WATCHDOG=1"
+)
+
+// Notify sends the state to the service manager. It's a no-op unless the process is run
+// by systemd as a Type=notify service.
+func Notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// Sockets in the abstract namespace are prefixed with @.
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("unable to connect to notify socket: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("unable to notify service manager: %w", err)
+	}
+	return nil
+}
+
+// WatchdogInterval returns the interval in which the service manager expects heartbeats,
+// zero if the watchdog isn't enabled for this process.
+func WatchdogInterval() (time.Duration, error) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec == "" {
+		return 0, nil
+	}
+
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid WATCHDOG_USEC: %q", usec)
+	}
+	return time.Duration(n) * time.Microsecond, nil
+}
+
+// Watchdog sends heartbeats at half of the interval until the context is done. Heartbeats
+// are skipped if the health check fails, so the service manager restarts a stuck process.
+func Watchdog(ctx context.Context, interval time.Duration, healthy func() error) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := healthy(); err != nil {
+				slog.Warn("Health check failed, skipping watchdog heartbeat", "error", err)
+				continue
+			}
+			if err := Notify(Heartbeat); err != nil {
+				slog.Warn("Watchdog heartbeat failed", "error", err)
+			}
+		}
+	}
+}
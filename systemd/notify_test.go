@@ -0,0 +1,110 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func listenNotifySocket(t *testing.T) *net.UnixConn {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("ListenUnixgram failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+func receive(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 256)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestNotify(t *testing.T) {
+	conn := listenNotifySocket(t)
+
+	if err := Notify(Ready); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if state := receive(t, conn); state != Ready {
+		t.Errorf("expected %q, got %q", Ready, state)
+	}
+}
+
+func TestNotifyWithoutSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+
+	if err := Notify(Ready); err != nil {
+		t.Errorf("expected no-op, got %v", err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+
+	cases := []struct {
+		name     string
+		usec     string
+		pid      string
+		expected time.Duration
+		err      bool
+	}{
+		{name: "disabled"},
+		{name: "enabled", usec: "30000000", expected: 30 * time.Second},
+		{name: "this process", usec: "30000000", pid: pid, expected: 30 * time.Second},
+		{name: "other process", usec: "30000000", pid: "1"},
+		{name: "invalid", usec: "soon", err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", c.usec)
+			t.Setenv("WATCHDOG_PID", c.pid)
+
+			interval, err := WatchdogInterval()
+			if (err != nil) != c.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if interval != c.expected {
+				t.Errorf("expected %s, got %s", c.expected, interval)
+			}
+		})
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	conn := listenNotifySocket(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var checks int
+	go Watchdog(ctx, 20*time.Millisecond, func() error {
+		checks++
+		if checks == 1 {
+			return errors.New("stuck")
+		}
+		return nil
+	})
+
+	// The first heartbeat is skipped, the next one must arrive.
+	if state := receive(t, conn); state != Heartbeat {
+		t.Errorf("expected %q, got %q", Heartbeat, state)
+	}
+}
@@ -0,0 +1,162 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+)
+
+const reloadInterval = 10 * time.Second
+
+// Reloader serves a certificate and reloads it when its files change on disk.
+type Reloader struct {
+	certFile, keyFile string
+
+	m        sync.RWMutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+}
+
+// NewReloader loads the certificate and its key from PEM files.
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	return r.cert, nil
+}
+
+// Reload loads the certificate if its files changed, and reports whether it did.
+func (r *Reloader) Reload() (bool, error) {
+	modTimes, err := r.fileModTimes()
+	if err != nil {
+		return false, err
+	}
+
+	r.m.RLock()
+	unchanged := r.cert != nil && modTimes == r.modTimes
+	r.m.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("unable to load certificate: %w", err)
+	}
+
+	r.m.Lock()
+	r.cert = &cert
+	r.modTimes = modTimes
+	r.m.Unlock()
+	return true, nil
+}
+
+// Run checks the files periodically until the context is done. The previous certificate
+// is kept if the new one can't be loaded, e.g. when only one of the files was replaced yet.
+func (r *Reloader) Run(ctx context.Context) {
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if err != nil {
+				slog.Warn("TLS certificate can't be reloaded, serving the previous one", "error", err)
+				continue
+			}
+			if reloaded {
+				slog.Info("TLS certificate reloaded", "cert", r.certFile)
+			}
+		}
+	}
+}
+
+func (r *Reloader) fileModTimes() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+	for i, name := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return modTimes, fmt.Errorf("unable to stat certificate file: %w", err)
+		}
+		modTimes[i] = fi.ModTime()
+	}
+	return modTimes, nil
+}
+
+// ServerConfig returns a TLS config serving the reloaded certificate, with client
+// certificates verified against the client CA if it's configured.
+func ServerConfig(c spiroflex.TLS, reloader *Reloader) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		// Only AEAD cipher suites with forward secrecy, TLS 1.3 suites aren't configurable.
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if c.ClientCA != "" {
+		pem, err := os.ReadFile(c.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read client CA: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in client CA")
+		}
+		config.ClientCAs = pool
+		// Clients without certificates can still authenticate with tokens or passwords.
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+// RedirectHandler redirects requests to the same host and path over HTTPS, served at httpsAddr.
+func RedirectHandler(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,122 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeCert(t *testing.T, dir, commonName string, modTime time.Time) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate failed: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey failed: %v", err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	for name, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(name, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if err := os.Chtimes(name, modTime, modTime); err != nil {
+			t.Fatalf("Chtimes failed: %v", err)
+		}
+	}
+	return certFile, keyFile
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	certFile, keyFile := writeCert(t, dir, "first", now.Add(-time.Minute))
+
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewReloader failed: %v", err)
+	}
+
+	commonName := func() string {
+		cert, _ := r.GetCertificate(nil)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatalf("ParseCertificate failed: %v", err)
+		}
+		return leaf.Subject.CommonName
+	}
+
+	if reloaded, err := r.Reload(); reloaded || err != nil {
+		t.Errorf("expected no reload of unchanged files, got %t, %v", reloaded, err)
+	}
+
+	writeCert(t, dir, "second", now)
+	if reloaded, err := r.Reload(); !reloaded || err != nil {
+		t.Fatalf("expected reload of changed files, got %t, %v", reloaded, err)
+	}
+	if cn := commonName(); cn != "second" {
+		t.Errorf("expected the new certificate, got %s", cn)
+	}
+
+	if err := os.WriteFile(keyFile, []byte("garbage"), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if _, err := r.Reload(); err == nil {
+		t.Error("expected error for invalid key")
+	}
+	if cn := commonName(); cn != "second" {
+		t.Errorf("expected the previous certificate to be kept, got %s", cn)
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		httpsAddr string
+		url       string
+		expected  string
+	}{
+		{httpsAddr: "0.0.0.0:443", url: "http://vent.example.com/api/vent/status?x=1", expected: "https://vent.example.com/api/vent/status?x=1"},
+		{httpsAddr: "0.0.0.0:7777", url: "http://vent.example.com:8080/alexa", expected: "https://vent.example.com:7777/alexa"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			RedirectHandler(tt.httpsAddr).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			if w.Code != http.StatusPermanentRedirect {
+				t.Errorf("expected status %d, got %d", http.StatusPermanentRedirect, w.Code)
+			}
+			if location := w.Header().Get("Location"); location != tt.expected {
+				t.Errorf("expected redirect to %s, got %s", tt.expected, location)
+			}
+		})
+	}
+}
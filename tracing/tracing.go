@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/mtojek/spiroflex-vent-clear"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const serviceName = "ventclear"
+
+// Setup installs the global tracer provider exporting spans as configured, stdout spans are
+// written to w. The returned function flushes pending spans, it's a no-op if tracing is disabled.
+func Setup(ctx context.Context, w io.Writer, c *spiroflex.Config) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch c.Tracing.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+	case spiroflex.TracingExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(w))
+	case spiroflex.TracingExporterOTLP:
+		var opts []otlptracehttp.Option
+		if c.Tracing.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(c.Tracing.Endpoint))
+		}
+		if c.Tracing.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("invalid tracing exporter: %s", c.Tracing.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to create %s exporter: %w", c.Tracing.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp.Shutdown, nil
+}
+
+// End records the error, if any, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}